@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 一条安全公告
+type advisory struct {
+	CVE        string   `json:"cve"`
+	Severity   string   `json:"severity"` // low、medium、high 或 critical
+	Summary    string   `json:"summary"`
+	Fixed      []string `json:"fixed"`                // 各主次版本中第一个修复的补丁版本
+	Introduced string   `json:"introduced,omitempty"` // 低于该版本的不受影响
+}
+
+// 严重程度，按从低到高排列
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+var severityNames = map[string]string{
+	"low":      "低",
+	"medium":   "中",
+	"high":     "高",
+	"critical": "严重",
+}
+
+func severityRank(s string) int {
+	for i, level := range severityLevels {
+		if level == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// 内置公告数据的截止日期
+const bundledAdvisoriesDate = "2025-07-03"
+
+// 内置的安全公告，来自 https://www.php.net/ChangeLog-8.php 和 php-src 的 GitHub 安全公告。
+// 可以通过 pvm audit update 更新
+var bundledAdvisories = []advisory{
+	{"CVE-2023-3824", "critical", "phar 读取目录项时的缓冲区溢出", []string{"8.0.30", "8.1.22", "8.2.8"}, ""},
+	{"CVE-2023-3823", "high", "libxml 全局状态导致可以加载外部实体", []string{"8.0.30", "8.1.22", "8.2.8"}, ""},
+	{"CVE-2024-1874", "high", "Windows 上 proc_open 以数组传参时的命令注入", []string{"8.1.28", "8.2.18", "8.3.5"}, ""},
+	{"CVE-2024-2756", "medium", "__Host-/__Secure- 前缀 Cookie 的保护可以被绕过", []string{"8.1.28", "8.2.18", "8.3.5"}, ""},
+	{"CVE-2024-3096", "medium", "password_verify 遇到以空字节开头的密码时可能验证通过", []string{"8.1.28", "8.2.18", "8.3.5"}, ""},
+	{"CVE-2024-4577", "critical", "Windows 上 PHP-CGI 的参数注入（代码页字符转换）", []string{"8.1.29", "8.2.20", "8.3.8"}, ""},
+	{"CVE-2024-5458", "medium", "filter_var 的 FILTER_VALIDATE_URL 校验可以被绕过", []string{"8.1.29", "8.2.20", "8.3.8"}, ""},
+	{"CVE-2024-5585", "high", "CVE-2024-1874 的修复不完整，proc_open 仍可命令注入", []string{"8.1.29", "8.2.20", "8.3.8"}, ""},
+	{"CVE-2024-8925", "medium", "multipart/form-data 边界处理错误", []string{"8.1.30", "8.2.24", "8.3.12"}, ""},
+	{"CVE-2024-8926", "high", "CVE-2024-4577 的修复在特定代码页下可以被绕过", []string{"8.1.30", "8.2.24", "8.3.12"}, ""},
+	{"CVE-2024-8927", "high", "cgi.force_redirect 配置可以被绕过", []string{"8.1.30", "8.2.24", "8.3.12"}, ""},
+	{"CVE-2024-9026", "low", "PHP-FPM 日志可以被篡改", []string{"8.1.30", "8.2.24", "8.3.12"}, ""},
+	{"CVE-2024-8929", "medium", "mysqlnd 可能泄露堆内存内容", []string{"8.1.31", "8.2.26", "8.3.14", "8.4.1"}, ""},
+	{"CVE-2024-8932", "high", "ldap_escape 在 32 位系统上的整数溢出", []string{"8.1.31", "8.2.26", "8.3.14", "8.4.1"}, ""},
+	{"CVE-2024-11233", "medium", "convert.quoted-printable-decode 过滤器越界读取", []string{"8.1.31", "8.2.26", "8.3.14", "8.4.1"}, ""},
+	{"CVE-2024-11234", "medium", "通过代理使用流时可以注入请求头", []string{"8.1.31", "8.2.26", "8.3.14", "8.4.1"}, ""},
+	{"CVE-2024-11236", "medium", "PDO dblib/firebird 引号转义的整数溢出", []string{"8.1.31", "8.2.26", "8.3.14", "8.4.1"}, ""},
+	{"CVE-2025-1736", "medium", "用户提供的请求头没有检查换行符", []string{"8.1.32", "8.2.28", "8.3.19", "8.4.5"}, ""},
+	{"CVE-2025-1861", "medium", "HTTP 重定向的 Location 地址被截断", []string{"8.1.32", "8.2.28", "8.3.19", "8.4.5"}, ""},
+	{"CVE-2025-1219", "medium", "libxml 流处理重定向时使用了错误的字符集", []string{"8.1.32", "8.2.28", "8.3.19", "8.4.5"}, ""},
+	{"CVE-2025-1220", "low", "部分函数没有检查主机名中的空字节", []string{"8.1.33", "8.2.29", "8.3.23", "8.4.10"}, ""},
+	{"CVE-2025-1735", "medium", "pgsql 扩展的转义函数没有检查错误", []string{"8.1.33", "8.2.29", "8.3.23", "8.4.10"}, ""},
+	{"CVE-2025-6491", "medium", "SOAP 扩展处理过长的 XML 命名空间前缀时空指针解引用", []string{"8.1.33", "8.2.29", "8.3.23", "8.4.10"}, ""},
+}
+
+func advisoriesPath() string {
+	return filepath.Join(cachePath(), "advisories.json")
+}
+
+// 当前使用的公告数据和它的来源说明：更新下载的数据整体替换内置数据
+func advisories() ([]advisory, string) {
+	data, err := os.ReadFile(advisoriesPath())
+	if err != nil {
+		return bundledAdvisories, "内置数据，截至 " + bundledAdvisoriesDate
+	}
+	list, err := parseAdvisories(data)
+	if err != nil {
+		warnf("安全公告数据 %s 无效，使用内置数据: %v\n", advisoriesPath(), err)
+		return bundledAdvisories, "内置数据，截至 " + bundledAdvisoriesDate
+	}
+	updated := ""
+	if info, err := os.Stat(advisoriesPath()); err == nil {
+		updated = "，更新于 " + info.ModTime().Format("2006-01-02")
+	}
+	return list, advisoriesPath() + updated
+}
+
+// 解析并检查公告数据，格式与 bundledAdvisories 的 JSON 形式相同
+func parseAdvisories(data []byte) ([]advisory, error) {
+	var list []advisory
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析安全公告数据失败: %v", err)
+	}
+	for i, a := range list {
+		if a.CVE == "" || len(a.Fixed) == 0 {
+			return nil, fmt.Errorf("第 %d 条公告缺少 cve 或 fixed", i+1)
+		}
+		list[i].Severity = strings.ToLower(a.Severity)
+		if severityRank(list[i].Severity) < 0 {
+			return nil, fmt.Errorf("%s 的严重程度无效: %s", a.CVE, a.Severity)
+		}
+	}
+	return list, nil
+}
+
+// 判断版本是否受公告影响，返回同一主次版本中修复的补丁版本。
+// 公告中没有列出的、比所有修复版本都旧的主次版本视为受影响且没有修复版本
+func (a advisory) affects(version string) (string, bool) {
+	if a.Introduced != "" && compareVersions(version, a.Introduced) < 0 {
+		return "", false
+	}
+	series := versionSeries(version)
+	oldest := ""
+	for _, fixed := range a.Fixed {
+		if versionSeries(fixed) == series {
+			return fixed, compareVersions(version, fixed) < 0
+		}
+		if oldest == "" || compareVersions(fixed, oldest) < 0 {
+			oldest = fixed
+		}
+	}
+	return "", compareVersions(series, versionSeries(oldest)) < 0
+}
+
+// audit 输出中的一个版本
+type auditEntry struct {
+	Key      string         `json:"key"`
+	Dir      string         `json:"dir"`
+	Version  string         `json:"version"`
+	Findings []auditFinding `json:"findings"`
+}
+
+// 影响某个版本的一条公告
+type auditFinding struct {
+	CVE      string `json:"cve"`
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Fixed    string `json:"fixed,omitempty"` // 为空表示该主次版本没有修复版本
+}
+
+// 检查已安装的版本是否受已知漏洞影响，有受影响的版本时以 exitCheck 退出
+func auditInstalled(minSeverity string) error {
+	minRank := 0
+	if minSeverity != "" {
+		if minRank = severityRank(strings.ToLower(minSeverity)); minRank < 0 {
+			return usageErrorf("无效的 --min-severity: %s，可选 %s", minSeverity, strings.Join(severityLevels, "、"))
+		}
+	}
+
+	m, err := loadManifest()
+	if err != nil {
+		return err
+	}
+	list, source := advisories()
+	debugf("使用安全公告数据: %s\n", source)
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return compareVersions(keys[i], keys[j]) < 0 })
+
+	entries := make([]auditEntry, 0, len(keys))
+	vulnerable := 0
+	for _, key := range keys {
+		r := m[key]
+		if r.Version == "" {
+			warnf("无法确定 %s（%s）的版本，跳过\n", key, r.Dir)
+			continue
+		}
+		e := auditEntry{Key: key, Dir: r.Dir, Version: r.Version, Findings: []auditFinding{}}
+		for _, a := range list {
+			if severityRank(a.Severity) < minRank {
+				continue
+			}
+			if fixed, ok := a.affects(r.Version); ok {
+				e.Findings = append(e.Findings, auditFinding{CVE: a.CVE, Severity: a.Severity, Summary: a.Summary, Fixed: fixed})
+			}
+		}
+		// 严重的排在前面
+		sort.SliceStable(e.Findings, func(i, j int) bool {
+			return severityRank(e.Findings[i].Severity) > severityRank(e.Findings[j].Severity)
+		})
+		if len(e.Findings) > 0 {
+			vulnerable++
+		}
+		entries = append(entries, e)
+	}
+
+	if jsonOutput {
+		if err := printJSON(entries); err != nil {
+			return err
+		}
+	} else {
+		if len(entries) == 0 {
+			infof("没有已安装的版本\n")
+			return nil
+		}
+		for _, e := range entries {
+			if len(e.Findings) == 0 {
+				continue
+			}
+			infof("%s (%s): %d 个已知漏洞\n", e.Key, e.Version, len(e.Findings))
+			for _, f := range e.Findings {
+				fixed := "该主次版本没有修复版本，请升级到更新的主次版本"
+				if f.Fixed != "" {
+					fixed = "修复于 " + f.Fixed
+				}
+				infof("  %-15s [%s] %s，%s\n", f.CVE, severityNames[f.Severity], f.Summary, fixed)
+			}
+		}
+		if vulnerable == 0 {
+			infof("没有发现受已知漏洞影响的版本（%s）\n", source)
+		} else {
+			infof("\n数据来源: %s，使用 pvm audit update 更新\n", source)
+		}
+	}
+
+	if vulnerable > 0 {
+		return withExitReported(exitCheck, fmt.Errorf("有 %d 个版本受已知漏洞影响", vulnerable))
+	}
+	return nil
+}
+
+// 从地址或本地文件更新安全公告数据
+func updateAdvisories(ctx context.Context, source string) error {
+	if source == "" {
+		source = cfg.AdvisoryURL
+	}
+	if source == "" {
+		return usageErrorf("没有设置数据来源，请使用 --from 指定地址或文件，或运行 pvm config set advisory_url <地址>")
+	}
+	data, err := readSource(ctx, source)
+	if err != nil {
+		return interrupted(ctx, withExit(exitNetwork, fmt.Errorf("读取安全公告数据失败: %v", err)))
+	}
+	list, err := parseAdvisories(data)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return errors.New("安全公告数据中没有公告")
+	}
+	if err := os.MkdirAll(cachePath(), 0755); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	if err := os.WriteFile(advisoriesPath(), data, 0644); err != nil {
+		return fmt.Errorf("保存安全公告数据失败: %v", err)
+	}
+	infof("已从 %s 更新 %d 条安全公告（%s）\n", source, len(list), time.Now().Format("2006-01-02"))
+	return nil
+}
+
+func newAuditCommand() *command {
+	var minSeverity, from string
+	return &command{
+		name:    "audit",
+		summary: "检查已安装的版本是否受已知漏洞影响",
+		description: `
+将每个已安装的版本与安全公告数据比较，列出影响它的 CVE、严重程度和同一主次版本中
+第一个修复的补丁版本。有受影响的版本时退出码为 6，可以在 CI 中作为检查使用。
+
+pvm 内置了一份公告数据，可以使用 pvm audit update 从 advisory_url 设置的地址或
+--from 指定的地址、文件更新。数据是 JSON 数组，每项包含 cve、severity
+（low/medium/high/critical）、summary、fixed（各主次版本的修复版本）和可选的 introduced。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&minSeverity, "min-severity", "", "只报告不低于该严重程度的漏洞: low、medium、high 或 critical")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "audit 命令不接受参数"); err != nil {
+				return err
+			}
+			return auditInstalled(minSeverity)
+		},
+		subcommands: []*command{
+			{
+				name:    "update",
+				summary: "更新安全公告数据",
+				setup: func(fs *flag.FlagSet) {
+					fs.StringVar(&from, "from", "", "数据的地址或本地文件，默认使用 advisory_url 设置")
+				},
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "audit update 命令不接受参数，请使用 --from 指定数据来源"); err != nil {
+						return err
+					}
+					return updateAdvisories(commandCtx, from)
+				},
+			},
+		},
+	}
+}
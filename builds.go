@@ -0,0 +1,373 @@
+package main
+
+import (
+	"debug/pe"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 一个 PHP 构建，对应官网上的一个 Windows 压缩包或 static-php-cli 的一个 Linux 压缩包
+type phpBuild struct {
+	Version   string `json:"version"`   // 完整版本号，例如 8.2.15、8.4.0RC2 或快照 8.4-dev
+	Flavour   string `json:"flavour"`   // ts 或 nts
+	Arch      string `json:"arch"`      // x64、x86 或 arm64
+	Toolchain string `json:"toolchain"` // 编译器版本，例如 vs16；静态构建为 static
+	File      string `json:"file"`      // 压缩包文件名
+}
+
+// 官网压缩包文件名，例如 php-8.2.15-nts-Win32-vs16-x64.zip、
+// 预发布版本 php-8.4.0RC2-Win32-vs17-x64.zip 和快照 php-8.4-dev-nts-Win32-vs17-x64.zip
+var buildNamePattern = regexp.MustCompile(`(?i)^php-(\d+\.\d+\.\d+(?:(?:alpha|beta|RC)\d+)?|\d+\.\d+(?:\.\d+)?-dev)(-nts)?-Win32-(v[cs]\d+)-(x64|x86)(\.zip)?$`)
+
+// 从压缩包或目录名解析当前平台的构建信息
+func parseBuildName(name string) (phpBuild, bool) {
+	if !isWindows {
+		return parseStaticBuildName(name)
+	}
+	m := buildNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return phpBuild{}, false
+	}
+	b := phpBuild{
+		Version:   normalizeVersion(m[1]),
+		Flavour:   "ts",
+		Arch:      strings.ToLower(m[4]),
+		Toolchain: strings.ToLower(m[3]),
+		File:      name,
+	}
+	if m[2] != "" {
+		b.Flavour = "nts"
+	}
+	return b, true
+}
+
+// 支持的压缩包扩展名
+var archiveExts = []string{".zip", ".tar.gz", ".tgz"}
+
+// 压缩包的扩展名，.tar.gz 作为一个整体
+func archiveExt(name string) string {
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[len(name)-len(ext):]
+		}
+	}
+	return path.Ext(name)
+}
+
+// 去掉压缩包的扩展名
+func trimArchiveExt(name string) string {
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// 按官网的命名规则生成目录名（不带 .zip）
+func (b phpBuild) dirName() string {
+	if b.Toolchain == staticToolchain {
+		return staticDirName(b)
+	}
+	name := "php-" + b.Version
+	if b.Flavour == "nts" {
+		name += "-nts"
+	}
+	return fmt.Sprintf("%s-Win32-%s-%s", name, toolchainName(b.Toolchain), b.Arch)
+}
+
+// 官网文件名中的编译器写法：7.2 之前为大写的 VC6、VC9、VC11、VC14，之后为小写的 vc15、vs16、vs17
+func toolchainName(t string) string {
+	if strings.HasPrefix(t, "vc") && toolchainRank(t) <= 14 {
+		return strings.ToUpper(t)
+	}
+	return t
+}
+
+// 主次版本号，例如 8.2
+func (b phpBuild) series() string {
+	return versionSeries(b.Version)
+}
+
+// 取版本号的主次部分
+func versionSeries(version string) string {
+	parts := strings.SplitN(splitVersion(version).base, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// 版本号的发布阶段，按从早到晚排列，与 PHP 的 version_compare 一致
+const (
+	stageDev = iota
+	stageAlpha
+	stageBeta
+	stageRC
+	stageFinal
+)
+
+var stageNames = map[string]int{"-dev": stageDev, "alpha": stageAlpha, "beta": stageBeta, "rc": stageRC}
+
+// 预发布版本号：8.4.0alpha1、8.4.0beta3、8.4.0RC2 和快照 8.4-dev
+var prereleasePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)*)(alpha|beta|rc|-dev)(\d*)$`)
+
+// 拆分后的版本号，例如 8.4.0RC2 为 {8.4.0, stageRC, 2}
+type versionParts struct {
+	base  string
+	stage int
+	num   int
+}
+
+func splitVersion(version string) versionParts {
+	m := prereleasePattern.FindStringSubmatch(version)
+	if m == nil {
+		return versionParts{base: version, stage: stageFinal}
+	}
+	num, _ := strconv.Atoi(m[3])
+	return versionParts{base: m[1], stage: stageNames[strings.ToLower(m[2])], num: num}
+}
+
+// 是否为预发布版本或快照
+func isPrerelease(version string) bool {
+	return splitVersion(version).stage != stageFinal
+}
+
+// 是否为开发快照，例如 8.4-dev
+func isSnapshot(version string) bool {
+	return splitVersion(version).stage == stageDev
+}
+
+// 按官网的写法规范化预发布版本号：RC 大写，alpha 和 beta 小写
+func normalizeVersion(version string) string {
+	m := prereleasePattern.FindStringSubmatch(version)
+	if m == nil {
+		return version
+	}
+	stage := strings.ToLower(m[2])
+	if stage == "rc" {
+		stage = "RC"
+	}
+	return m[1] + stage + m[3]
+}
+
+// 比较两个点分版本号，a < b 返回负数，相等返回 0，a > b 返回正数。
+// 同一版本号的快照、alpha、beta、RC 依次早于正式版本，例如 8.4.0RC2 < 8.4.0
+func compareVersions(a, b string) int {
+	va, vb := splitVersion(a), splitVersion(b)
+	if cmp := compareNumbers(va.base, vb.base, -1); cmp != 0 {
+		return cmp
+	}
+	if va.stage != vb.stage {
+		return va.stage - vb.stage
+	}
+	return va.num - vb.num
+}
+
+// 比较点分数字的前 n 部分，n 为负数时比较全部，缺少的部分按 0 处理
+func compareNumbers(a, b string, n int) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; (i < len(pa) || i < len(pb)) && (n < 0 || i < n); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// 判断完整版本号是否匹配用户输入的版本（8、8.2 或 8.2.15）
+func versionMatches(version, want string) bool {
+	return version == want || strings.HasPrefix(version, want+".")
+}
+
+// 选择下载的构建时 a 是否优先于 b：版本更新的优先；同一版本优先选择 x64、线程安全和较新的编译器
+func preferBuild(a, b phpBuild) bool {
+	if cmp := compareVersions(a.Version, b.Version); cmp != 0 {
+		return cmp > 0
+	}
+	if a.Arch != b.Arch {
+		return a.Arch == hostArch()
+	}
+	if a.Flavour != b.Flavour {
+		return a.Flavour == "ts"
+	}
+	return toolchainRank(a.Toolchain) > toolchainRank(b.Toolchain)
+}
+
+// 编译器标识中的版本号，例如 vc9 为 9，vs17 为 17
+func toolchainRank(t string) int {
+	n, _ := strconv.Atoi(strings.TrimLeft(strings.ToLower(t), "vcs"))
+	return n
+}
+
+// Visual C++ 版本年份对应的编译器标识
+var msvcToolchains = map[string]string{
+	"2008": "vc9",
+	"2012": "vc11",
+	"2015": "vc14",
+	"2017": "vc15",
+	"2019": "vs16",
+	"2022": "vs17",
+}
+
+// 解析 php -v 的第一行，例如
+// PHP 8.2.15 (cli) (built: Jan 16 2024 12:19:32) (NTS Visual C++ 2019 x64)
+var phpVersionLine = regexp.MustCompile(`^PHP (\d+\.\d+\.\d+(?:(?:alpha|beta|RC)\d+|-dev)?)\S* \(cli\)(.*)$`)
+
+func parsePHPVersionOutput(output string) (phpBuild, bool) {
+	line := strings.TrimSpace(strings.SplitN(output, "\n", 2)[0])
+	m := phpVersionLine.FindStringSubmatch(line)
+	if m == nil {
+		return phpBuild{}, false
+	}
+	b := phpBuild{Version: normalizeVersion(m[1]), Flavour: "ts", Arch: "x64"}
+	rest := m[2]
+	if strings.Contains(rest, "NTS") {
+		b.Flavour = "nts"
+	}
+	if strings.Contains(rest, "x86") {
+		b.Arch = "x86"
+	}
+	if vc := regexp.MustCompile(`Visual C\+\+ (\d{4})`).FindStringSubmatch(rest); vc != nil {
+		b.Toolchain = msvcToolchains[vc[1]]
+	} else if vc := regexp.MustCompile(`MSVC(\d+)`).FindStringSubmatch(rest); vc != nil {
+		// 没有年份、只有 MSVC 编号的输出，例如 (ZTS MSVC14 x86)
+		b.Toolchain = "vc" + vc[1]
+	}
+	return b, true
+}
+
+// 版本约束。8、8.2、8.2.15 匹配该前缀的版本；也可以使用 >=、>、<=、<、= 比较，
+// 多个条件用逗号分隔，例如 ">=8.1,<8.3"。比较时只比较约束中给出的部分，
+// 所以 "<=8.2" 包含所有 8.2.x，">8.2" 从 8.3 开始。
+// 与 Composer 一样，^8.2 等同于 ">=8.2,<9"，~8.2.3 等同于 ">=8.2.3,<8.3"，~8.2 等同于 ">=8.2,<9"。
+// 给出完整版本号或预发布版本号时还比较发布阶段，所以 ">=8.4.0" 不包含 8.4.0RC1
+type versionConstraint []constraintTerm
+
+type constraintTerm struct {
+	op      string
+	version string
+}
+
+var constraintTermPattern = regexp.MustCompile(`(?i)^(>=|<=|>|<|=|\^|~)?\s*(\d+(?:\.\d+){0,2}(?:(?:alpha|beta|RC)\d+|-dev)?)$`)
+
+func parseConstraint(s string) (versionConstraint, error) {
+	var c versionConstraint
+	for _, part := range strings.Split(s, ",") {
+		m := constraintTermPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("无效的版本约束: %s", s)
+		}
+		op, version := m[1], normalizeVersion(m[2])
+		switch op {
+		case "":
+			c = append(c, constraintTerm{op: "=", version: version})
+		case "^", "~":
+			c = append(c, constraintTerm{op: ">=", version: version}, constraintTerm{op: "<", version: upperBound(op, version)})
+		default:
+			c = append(c, constraintTerm{op: op, version: version})
+		}
+	}
+	return c, nil
+}
+
+// ^ 和 ~ 约束不包含的上限：^ 为下一个主版本，~ 为去掉最后一部分后的下一个版本
+func upperBound(op, version string) string {
+	parts := strings.Split(splitVersion(version).base, ".")
+	keep := 1
+	if op == "~" && len(parts) > 2 {
+		keep = len(parts) - 1
+	}
+	parts = parts[:keep]
+	n, _ := strconv.Atoi(parts[keep-1])
+	parts[keep-1] = strconv.Itoa(n + 1)
+	return strings.Join(parts, ".")
+}
+
+func (c versionConstraint) matches(version string) bool {
+	v := splitVersion(version)
+	for _, t := range c {
+		tv := splitVersion(t.version)
+		n := len(strings.Split(tv.base, "."))
+		cmp := compareNumbers(v.base, tv.base, n)
+		if cmp == 0 && (n >= 3 || tv.stage != stageFinal) {
+			if cmp = v.stage - tv.stage; cmp == 0 {
+				cmp = v.num - tv.num
+			}
+		}
+		var ok bool
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// 约束中是否明确给出了预发布版本，例如 ">=8.4.0RC1"。
+// 没有给出时不选择预发布版本，除非使用了 --pre
+func (c versionConstraint) allowsPrerelease() bool {
+	for _, t := range c {
+		if isPrerelease(t.version) {
+			return true
+		}
+	}
+	return false
+}
+
+// C 运行库对应的编译器标识。VCRUNTIME140 由 VC14 到 vs17 共用，
+// 只在 php -v 没有给出编译器时使用，这时只可能是 7.0 或 7.1
+var runtimeToolchains = map[string]string{
+	"msvcrt.dll":       "vc6",
+	"msvcr90.dll":      "vc9",
+	"msvcr110.dll":     "vc11",
+	"vcruntime140.dll": "vc14",
+}
+
+// 从 Windows 可执行文件的文件头读取架构，并根据导入的 C 运行库推断编译器
+func inspectExecutable(name string) (string, string, error) {
+	f, err := pe.Open(name)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	var arch string
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		arch = "x86"
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		arch = "x64"
+	default:
+		return "", "", fmt.Errorf("不支持的架构: 0x%x", f.Machine)
+	}
+	libs, _ := f.ImportedLibraries()
+	toolchain := ""
+	for _, lib := range libs {
+		if t, ok := runtimeToolchains[strings.ToLower(lib)]; ok {
+			toolchain = t
+			break
+		}
+	}
+	return arch, toolchain, nil
+}
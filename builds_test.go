@@ -0,0 +1,154 @@
+package main
+
+import "testing"
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"8", []string{"8.0.0", "8.3.4"}, []string{"7.4.33", "9.0.0"}},
+		{"8.2", []string{"8.2.0", "8.2.15"}, []string{"8.1.27", "8.20.1", "8.3.0"}},
+		{"8.2.15", []string{"8.2.15"}, []string{"8.2.1", "8.2.150", "8.2.15RC1"}},
+		{"=8.2", []string{"8.2.3"}, []string{"8.3.0"}},
+		{">=8.1,<8.3", []string{"8.1.0", "8.2.27"}, []string{"8.0.30", "8.3.0"}},
+		{"<=8.2", []string{"7.4.33", "8.2.99"}, []string{"8.3.0"}},
+		{">8.2", []string{"8.3.0", "9.0.0"}, []string{"8.2.99"}},
+		{"<8.2.3", []string{"8.2.2", "8.2.3RC1"}, []string{"8.2.3", "8.3.0"}},
+		{"^8.2", []string{"8.2.0", "8.4.1"}, []string{"8.1.27", "9.0.0", "9.0.0RC1"}},
+		{"^8.2.3", []string{"8.2.3", "8.9.0"}, []string{"8.2.2", "9.0.0"}},
+		{"~8.2", []string{"8.2.0", "8.4.1"}, []string{"8.1.27", "9.0.0"}},
+		{"~8.2.3", []string{"8.2.3", "8.2.20"}, []string{"8.2.2", "8.3.0"}},
+		{" >= 8.1 , ~8.2.0 ", []string{"8.2.7"}, []string{"8.1.5", "8.3.0"}},
+		{">=8.4.0", []string{"8.4.0", "8.4.1"}, []string{"8.4.0RC2", "8.4.0beta1", "8.3.99"}},
+		{">=8.4.0RC1", []string{"8.4.0RC1", "8.4.0RC2", "8.4.0"}, []string{"8.4.0beta3", "8.4.0alpha1"}},
+		{"^8.4.0rc1", []string{"8.4.0RC1", "8.5.0"}, []string{"8.4.0beta1", "9.0.0"}},
+		{"8.4-dev", []string{"8.4-dev"}, []string{"8.4.0", "8.4.0alpha1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := parseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range tt.match {
+				if !c.matches(v) {
+					t.Errorf("%q should match %s", tt.constraint, v)
+				}
+			}
+			for _, v := range tt.noMatch {
+				if c.matches(v) {
+					t.Errorf("%q should not match %s", tt.constraint, v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, s := range []string{"", "latest", ">=", "8.2.3.4", "^^8", "~>8.2", ">=8.1;<8.3", "8.x"} {
+		if _, err := parseConstraint(s); err == nil {
+			t.Errorf("parseConstraint(%q) should fail", s)
+		}
+	}
+}
+
+func TestConstraintAllowsPrerelease(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       bool
+	}{
+		{"8.4", false},
+		{">=8.4.0", false},
+		{"^8.4", false},
+		{">=8.4.0RC1", true},
+		{"^8.4.0beta1", true},
+		{"8.4-dev", true},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.allowsPrerelease(); got != tt.want {
+			t.Errorf("%q allowsPrerelease = %v, want %v", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	// 每一项都早于下一项
+	ordered := []string{
+		"7.4.33",
+		"8.0.0",
+		"8.2.9",
+		"8.2.10",
+		"8.4-dev",
+		"8.4.0alpha1",
+		"8.4.0alpha2",
+		"8.4.0beta1",
+		"8.4.0beta3",
+		"8.4.0RC1",
+		"8.4.0RC2",
+		"8.4.0RC10",
+		"8.4.0",
+		"8.4.1",
+		"8.10.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			got := compareVersions(ordered[i], ordered[j])
+			switch {
+			case i < j && got >= 0, i > j && got <= 0, i == j && got != 0:
+				t.Errorf("compareVersions(%s, %s) = %d", ordered[i], ordered[j], got)
+			}
+		}
+	}
+
+	equal := [][2]string{
+		{"8.2", "8.2.0"},
+		{"8.4.0RC1", "8.4.0rc1"},
+		{"8.4.0-dev", "8.4.0-DEV"},
+	}
+	for _, p := range equal {
+		if got := compareVersions(p[0], p[1]); got != 0 {
+			t.Errorf("compareVersions(%s, %s) = %d, want 0", p[0], p[1], got)
+		}
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		version    string
+		want       versionParts
+		prerelease bool
+		snapshot   bool
+		normalized string
+	}{
+		{"8.3.4", versionParts{"8.3.4", stageFinal, 0}, false, false, "8.3.4"},
+		{"8.4.0RC2", versionParts{"8.4.0", stageRC, 2}, true, false, "8.4.0RC2"},
+		{"8.4.0rc2", versionParts{"8.4.0", stageRC, 2}, true, false, "8.4.0RC2"},
+		{"8.4.0Beta3", versionParts{"8.4.0", stageBeta, 3}, true, false, "8.4.0beta3"},
+		{"8.4.0ALPHA1", versionParts{"8.4.0", stageAlpha, 1}, true, false, "8.4.0alpha1"},
+		{"8.4-dev", versionParts{"8.4", stageDev, 0}, true, true, "8.4-dev"},
+		{"8.4.0-dev", versionParts{"8.4.0", stageDev, 0}, true, true, "8.4.0-dev"},
+		{"8.4.0RC", versionParts{"8.4.0", stageRC, 0}, true, false, "8.4.0RC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := splitVersion(tt.version); got != tt.want {
+				t.Errorf("splitVersion = %+v, want %+v", got, tt.want)
+			}
+			if got := isPrerelease(tt.version); got != tt.prerelease {
+				t.Errorf("isPrerelease = %v, want %v", got, tt.prerelease)
+			}
+			if got := isSnapshot(tt.version); got != tt.snapshot {
+				t.Errorf("isSnapshot = %v, want %v", got, tt.snapshot)
+			}
+			if got := normalizeVersion(tt.version); got != tt.normalized {
+				t.Errorf("normalizeVersion = %q, want %q", got, tt.normalized)
+			}
+		})
+	}
+}
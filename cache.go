@@ -0,0 +1,553 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 下载缓存中的一项，按文件名索引，内容按 SHA-256 存放
+type cacheEntry struct {
+	File       string    `json:"file"`
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	URL        string    `json:"url"`
+	Downloaded time.Time `json:"downloaded"`
+	LastUsed   time.Time `json:"last_used"`
+}
+
+// 内容寻址的下载缓存，可以被多个并发的下载共用
+type downloadCache struct {
+	dir       string
+	entries   map[string]*cacheEntry
+	checksums map[string]map[string]string // 目录 URL => 文件名 => SHA-256
+
+	mu       sync.Mutex             // 保护 entries、checksums 和索引文件，网络请求和计算校验和时不持有
+	inflight map[string]*sync.Mutex // 文件名 => 下载锁，避免同一个文件被同时下载
+}
+
+// 服务器返回了非 200 状态码
+type httpStatusError struct {
+	url    string
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("下载 %s 失败，状态码: %d", e.url, e.status)
+}
+
+// 下载缓存目录
+func downloadCachePath() string {
+	return filepath.Join(cachePath(), "downloads")
+}
+
+// 打开下载缓存，读取索引
+func openDownloadCache() (*downloadCache, error) {
+	c := &downloadCache{
+		dir:       downloadCachePath(),
+		entries:   make(map[string]*cacheEntry),
+		checksums: make(map[string]map[string]string),
+		inflight:  make(map[string]*sync.Mutex),
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建下载缓存目录失败: %v", err)
+	}
+	data, err := os.ReadFile(c.indexFile())
+	if err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			warnf("下载缓存索引已损坏，将重新建立: %v\n", err)
+			c.entries = make(map[string]*cacheEntry)
+		}
+	}
+	return c, nil
+}
+
+func (c *downloadCache) indexFile() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+// 缓存文件的实际路径
+func (c *downloadCache) blobPath(e *cacheEntry) string {
+	return filepath.Join(c.dir, e.SHA256+archiveExt(e.File))
+}
+
+// 保存索引
+func (c *downloadCache) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("保存下载缓存索引失败: %v", err)
+	}
+	if err := os.WriteFile(c.indexFile(), data, 0644); err != nil {
+		return fmt.Errorf("写入下载缓存索引失败: %v", err)
+	}
+	return nil
+}
+
+// 查找可重用的缓存文件。校验和与官网公布的不一致或文件已损坏时视为未命中
+func (c *downloadCache) lookup(ctx context.Context, url string) (string, bool) {
+	name := path.Base(url)
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	var entry cacheEntry
+	if ok {
+		entry = *e
+	}
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	blob := c.blobPath(&entry)
+	if expected := c.expectedChecksum(ctx, url); expected != "" && !strings.EqualFold(expected, entry.SHA256) {
+		debugf("缓存的 %s 与官网校验和不一致，重新下载\n", entry.File)
+		return "", false
+	}
+	sum, err := fileSHA256(blob)
+	if err != nil || sum != entry.SHA256 {
+		debugf("缓存文件 %s 不可用，重新下载\n", blob)
+		return "", false
+	}
+	c.touch(name, entry.SHA256)
+	return blob, true
+}
+
+// 更新条目的最近使用时间，条目在检查期间被替换时不做修改
+func (c *downloadCache) touch(name, sum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok || e.SHA256 != sum {
+		return
+	}
+	e.LastUsed = time.Now()
+	if err := c.save(); err != nil {
+		debugf("%v\n", err)
+	}
+}
+
+// 是否还有其他条目使用与 e 相同的缓存文件
+func (c *downloadCache) blobShared(e *cacheEntry) bool {
+	blob := c.blobPath(e)
+	for _, other := range c.entries {
+		if other != e && c.blobPath(other) == blob {
+			return true
+		}
+	}
+	return false
+}
+
+// 从缓存中删除某个文件，用于内容会变化的快照。其他条目仍在使用的缓存文件保留
+func (c *downloadCache) forget(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[filename]
+	if !ok {
+		return
+	}
+	if !c.blobShared(e) {
+		os.Remove(c.blobPath(e))
+	}
+	delete(c.entries, filename)
+	if err := c.save(); err != nil {
+		debugf("%v\n", err)
+	}
+}
+
+// 在缓存中查找匹配版本（8、8.2 或 8.2.15）的最新构建，用于离线安装。
+// 只使用索引中记录的校验和验证文件
+func (c *downloadCache) findBuild(version string) (string, phpBuild, bool) {
+	type candidate struct {
+		entry cacheEntry
+		build phpBuild
+	}
+	var candidates []candidate
+	c.mu.Lock()
+	for _, e := range c.entries {
+		b, ok := parseBuildName(trimArchiveExt(e.File))
+		if !ok || !versionMatches(b.Version, version) {
+			continue
+		}
+		// 没有明确要求时不选择预发布版本
+		if isPrerelease(b.Version) && !isPrerelease(version) && !includePrerelease {
+			continue
+		}
+		candidates = append(candidates, candidate{*e, b})
+	}
+	c.mu.Unlock()
+
+	// 从最新的版本开始检查文件，第一个完好的即为结果
+	sort.Slice(candidates, func(i, j int) bool {
+		if cmp := compareVersions(candidates[i].build.Version, candidates[j].build.Version); cmp != 0 {
+			return cmp > 0
+		}
+		return candidates[i].entry.File < candidates[j].entry.File
+	})
+	for _, cand := range candidates {
+		if sum, err := fileSHA256(c.blobPath(&cand.entry)); err != nil || sum != cand.entry.SHA256 {
+			debugf("缓存文件 %s 不可用\n", cand.entry.File)
+			continue
+		}
+		c.touch(cand.entry.File, cand.entry.SHA256)
+		return c.blobPath(&cand.entry), cand.build, true
+	}
+	return "", phpBuild{}, false
+}
+
+// 下载文件到缓存。未完成的下载保留为 .part 文件，下次从中断处继续
+func (c *downloadCache) fetch(ctx context.Context, url string) (string, error) {
+	filename := path.Base(url)
+
+	// 同一个文件同时只下载一次，等待的一方直接使用下载好的文件
+	c.mu.Lock()
+	lock, ok := c.inflight[filename]
+	if !ok {
+		lock = new(sync.Mutex)
+		c.inflight[filename] = lock
+	}
+	c.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+	if cached, ok := c.lookup(ctx, url); ok {
+		return cached, nil
+	}
+
+	part := filepath.Join(c.dir, filename+".part")
+	n, err := downloadFile(ctx, url, part)
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return "", fmt.Errorf("计算校验和失败: %v", err)
+	}
+	if expected := c.expectedChecksum(ctx, url); expected != "" && !strings.EqualFold(expected, sum) {
+		os.Remove(part)
+		return "", withExit(exitChecksum, fmt.Errorf("%s 校验失败: 期望 %s，实际 %s", filename, expected, sum))
+	}
+
+	e := &cacheEntry{
+		File:       filename,
+		SHA256:     sum,
+		Size:       n,
+		URL:        url,
+		Downloaded: time.Now(),
+		LastUsed:   time.Now(),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(part, c.blobPath(e)); err != nil {
+		return "", fmt.Errorf("保存到下载缓存失败: %v", err)
+	}
+	c.entries[filename] = e
+	if err := c.save(); err != nil {
+		return "", err
+	}
+	infof("下载完成，文件大小: %s\n", formatSize(n))
+	return c.blobPath(e), nil
+}
+
+// 获取官网公布的校验和，目录下的 sha256sum.txt 每次运行只读取一次；取不到时返回空字符串。
+// 读取时不持有 c.mu，并发的下载可能各自读取一次
+func (c *downloadCache) expectedChecksum(ctx context.Context, url string) string {
+	dir := url[:strings.LastIndex(url, "/")+1]
+	c.mu.Lock()
+	sums, ok := c.checksums[dir]
+	c.mu.Unlock()
+	if !ok {
+		sums = fetchChecksums(ctx, dir+"sha256sum.txt")
+		if ctx.Err() == nil {
+			c.mu.Lock()
+			c.checksums[dir] = sums
+			c.mu.Unlock()
+		}
+	}
+	return sums[path.Base(url)]
+}
+
+// 读取 sha256sum.txt，格式为 "<校验和> *<文件名>"
+func fetchChecksums(ctx context.Context, url string) map[string]string {
+	sums := make(map[string]string)
+	body, err := openURL(ctx, url)
+	if err != nil {
+		debugf("获取校验和失败: %v\n", err)
+		return sums
+	}
+	defer body.Close()
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	return sums
+}
+
+// 计算文件的 SHA-256
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 超过该时长的临时文件视为上次运行的残留
+const staleTempAge = 24 * time.Hour
+
+// 临时文件目录（解压目录和生成的脚本）
+func tempPath() string {
+	return filepath.Join(os.TempDir(), "pvm")
+}
+
+// 清理残留的解压目录、生成的脚本以及旧版本留在临时目录中的压缩包
+func cleanTempArtifacts(maxAge time.Duration) (int64, error) {
+	var patterns = []string{
+		filepath.Join(tempPath(), "extract-*"),
+		filepath.Join(tempPath(), "build-*"),
+		filepath.Join(tempPath(), "*.zip"),
+		filepath.Join(os.TempDir(), "pvm_*.bat"),
+		filepath.Join(phpsPath(), ".staging-*"),
+		filepath.Join(rootDir, ".php_home-*"),
+	}
+	var freed int64
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return freed, err
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || time.Since(info.ModTime()) < maxAge {
+				continue
+			}
+			size := dirSize(m)
+			if err := os.RemoveAll(m); err != nil {
+				debugf("删除 %s 失败: %v\n", m, err)
+				continue
+			}
+			debugf("已删除 %s\n", m)
+			freed += size
+		}
+	}
+	return freed, nil
+}
+
+// 计算文件或目录的总大小
+func dirSize(name string) int64 {
+	var size int64
+	filepath.Walk(name, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// 以易读的形式显示字节数
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// 解析时长，除 Go 的时长格式外还支持以 d 结尾的天数，例如 30d
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("无效的时长: %s", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的时长: %s", s)
+	}
+	return d, nil
+}
+
+// 按最近使用时间排序的缓存条目
+func (c *downloadCache) sortedEntries() []*cacheEntry {
+	list := make([]*cacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastUsed.After(list[j].LastUsed) })
+	return list
+}
+
+func newCacheCommand() *command {
+	var olderThan string
+	return &command{
+		name:    "cache",
+		summary: "管理下载缓存",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "列出缓存的下载文件及占用空间",
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "cache list 命令不接受参数"); err != nil {
+						return err
+					}
+					return listCache()
+				},
+			},
+			{
+				name:    "clean",
+				summary: "清理下载缓存和临时文件",
+				description: `
+默认清空全部下载缓存；指定 --older-than 时只删除超过该时长未使用的文件。
+同时会删除残留的解压目录和生成的临时脚本。`,
+				setup: func(fs *flag.FlagSet) {
+					fs.StringVar(&olderThan, "older-than", "", "只删除超过该时长未使用的文件，例如 30d、72h")
+				},
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "cache clean 命令不接受参数"); err != nil {
+						return err
+					}
+					var maxAge time.Duration
+					if olderThan != "" {
+						d, err := parseAge(olderThan)
+						if err != nil {
+							return withExit(exitUsage, err)
+						}
+						maxAge = d
+					}
+					return cleanCache(maxAge)
+				},
+			},
+		},
+	}
+}
+
+func listCache() error {
+	c, err := openDownloadCache()
+	if err != nil {
+		return err
+	}
+	entries := c.sortedEntries()
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]interface{}{
+			"dir":     c.dir,
+			"entries": entries,
+			"total":   total,
+		})
+	}
+
+	infof("下载缓存目录: %s\n", c.dir)
+	if len(entries) == 0 {
+		infof("缓存为空\n")
+		return nil
+	}
+	for _, e := range entries {
+		infof("  %s\n", e.File)
+		infof("      大小: %s, SHA-256: %s, 最近使用: %s\n", formatSize(e.Size), shortSum(e.SHA256), e.LastUsed.Format("2006-01-02 15:04:05"))
+	}
+	infof("共 %d 个文件，占用 %s\n", len(entries), formatSize(total))
+	return nil
+}
+
+// 列表中显示的校验和前缀，手动修改过的索引中校验和可能不足 12 位
+func shortSum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// 删除超过 maxAge 未使用的缓存文件，maxAge 为 0 时全部删除
+func cleanCache(maxAge time.Duration) error {
+	c, err := openDownloadCache()
+	if err != nil {
+		return err
+	}
+
+	var freed int64
+	removed := 0
+	for name, e := range c.entries {
+		if time.Since(e.LastUsed) < maxAge {
+			continue
+		}
+		// 内容相同的文件共用一个缓存文件，最后一个使用它的条目删除时才删除文件
+		if !c.blobShared(e) {
+			if err := os.Remove(c.blobPath(e)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				warnf("删除 %s 失败: %v\n", e.File, err)
+				continue
+			}
+			freed += e.Size
+		}
+		delete(c.entries, name)
+		removed++
+	}
+
+	// 删除不在索引中的文件（中断的下载等）
+	files, _ := os.ReadDir(c.dir)
+	known := make(map[string]bool)
+	for _, e := range c.entries {
+		known[filepath.Base(c.blobPath(e))] = true
+	}
+	for _, f := range files {
+		if f.IsDir() || f.Name() == "index.json" || known[f.Name()] {
+			continue
+		}
+		p := filepath.Join(c.dir, f.Name())
+		info, err := f.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if os.Remove(p) == nil {
+			freed += info.Size()
+		}
+	}
+
+	if err := c.save(); err != nil {
+		return err
+	}
+
+	// 临时目录可能正被同时运行的 install 或 use 使用，不论 --older-than 都只删除残留的
+	tempFreed, err := cleanTempArtifacts(staleTempAge)
+	if err != nil {
+		warnf("清理临时文件失败: %v\n", err)
+	}
+	freed += tempFreed
+
+	if jsonOutput {
+		return printJSON(map[string]interface{}{"removed": removed, "freed": freed})
+	}
+	infof("已删除 %d 个缓存文件，释放 %s\n", removed, formatSize(freed))
+	return nil
+}
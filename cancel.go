@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+// 命令被 Ctrl+C 或 SIGTERM 中断
+var errInterrupted = withExit(exitCanceled, errors.New("操作已中断"))
+
+// 当前命令的上下文，由 runCommand 设置，收到中断信号时取消
+var commandCtx = context.Background()
+
+// 收到 Ctrl+C 或 SIGTERM 时取消的上下文。第一次中断时停止当前操作并回滚，
+// 之后恢复默认的信号处理，再按一次 Ctrl+C 会立即退出
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			warnf("收到中断信号，正在停止并恢复到执行命令前的状态（再按一次 Ctrl+C 立即退出）...\n")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// 上下文已取消时返回 errInterrupted，否则原样返回 err。
+// 用于外部命令等被取消时只返回笼统错误的地方
+func interrupted(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	return err
+}
+
+// 在上下文取消后停止读取的 Reader，用于复制文件
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, errInterrupted
+	}
+	return r.r.Read(p)
+}
+
+// 用新目录替换已有目录，在后续步骤失败时可以恢复原来的内容
+type dirSwap struct {
+	target  string
+	backup  string // 原目录的备份，原目录不存在时为空
+	renamed bool   // 是否通过重命名完成替换
+}
+
+// 用 staging 替换 target。优先整体重命名；target 中有文件被占用无法重命名时，
+// 先备份 target 的内容，再清空并复制 staging 的内容
+func replaceDir(ctx context.Context, staging, target string) (*dirSwap, error) {
+	s := &dirSwap{target: target, backup: filepath.Join(filepath.Dir(target), ".backup-"+filepath.Base(target))}
+	os.RemoveAll(s.backup)
+
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		s.backup = ""
+		if err := os.Rename(staging, target); err != nil {
+			return nil, fmt.Errorf("移动 %s 失败: %v", target, err)
+		}
+		s.renamed = true
+		return s, nil
+	}
+
+	if err := os.Rename(target, s.backup); err == nil {
+		if err := os.Rename(staging, target); err != nil {
+			os.Rename(s.backup, target)
+			return nil, fmt.Errorf("移动 %s 失败: %v", target, err)
+		}
+		s.renamed = true
+		return s, nil
+	}
+
+	debugf("无法重命名 %s，改为复制\n", target)
+	if err := copyDirectory(ctx, target, s.backup); err != nil {
+		os.RemoveAll(s.backup)
+		return nil, interrupted(ctx, fmt.Errorf("备份 %s 失败: %v", target, err))
+	}
+	err := removeContents(target)
+	if err == nil {
+		err = copyDirectory(ctx, staging, target)
+	}
+	if err != nil {
+		s.rollback()
+		return nil, interrupted(ctx, fmt.Errorf("复制到 %s 失败: %v", target, err))
+	}
+	return s, nil
+}
+
+// 确认替换，删除备份
+func (s *dirSwap) commit() {
+	if s.backup != "" {
+		os.RemoveAll(s.backup)
+	}
+}
+
+// 撤销替换，恢复原来的目录
+func (s *dirSwap) rollback() {
+	if s.renamed {
+		os.RemoveAll(s.target)
+		if s.backup != "" {
+			os.Rename(s.backup, s.target)
+		}
+		return
+	}
+	if err := removeContents(s.target); err != nil {
+		warnf("恢复 %s 失败: %v\n", s.target, err)
+		return
+	}
+	if err := copyDirectory(context.Background(), s.backup, s.target); err != nil {
+		warnf("恢复 %s 失败: %v，备份保留在 %s\n", s.target, err, s.backup)
+		return
+	}
+	os.RemoveAll(s.backup)
+}
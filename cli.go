@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 退出码
+//
+//	0  成功
+//	1  一般错误
+//	2  命令行用法错误（未知命令、参数缺失或无效）
+//	3  找不到指定的版本
+//	4  网络或下载失败
+//	5  用户取消了操作
+//	6  检查未通过（例如 outdated 发现可以更新的版本）
+//	7  下载的文件校验失败
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitNetwork  = 4
+	exitCanceled = 5
+	exitCheck    = 6
+	exitChecksum = 7
+)
+
+// 用户拒绝确认时返回的错误
+var errCanceled = withExit(exitCanceled, errors.New("操作已取消"))
+
+// 带退出码的错误
+type codedError struct {
+	code     int
+	err      error
+	reported bool // 结果已经以 JSON 输出，--json 模式下不再输出错误对象
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// 为错误附加退出码
+func withExit(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// 命令已经输出了 JSON 结果，只需要以非零退出码结束时使用
+func withExitReported(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err, reported: true}
+}
+
+// 构造用法错误
+func usageErrorf(format string, a ...interface{}) error {
+	return withExit(exitUsage, fmt.Errorf(format, a...))
+}
+
+// 从错误中取出退出码
+func exitCodeOf(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ee *codedError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitError
+}
+
+// 子命令定义
+type command struct {
+	name        string
+	args        string                 // 参数说明，例如 "<版本>"
+	summary     string                 // 一行简介
+	description string                 // 详细说明（可选）
+	setup       func(fs *flag.FlagSet) // 注册子命令专属参数（可选）
+	run         func(args []string) error
+	subcommands []*command
+	hidden      bool                         // 不在帮助和补全中显示
+	completeArg func(args []string) []string // 补全位置参数的候选值（可选）
+}
+
+// 所有顶层命令，在 commands.go 中注册
+var commands []*command
+
+// 根目录参数的值
+var rootFlag string
+
+// 注册全局参数。每个子命令的 FlagSet 也会注册一份，使全局参数可以出现在任意位置
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&rootFlag, "root", rootFlag, "pvm 根目录（默认取环境变量 PVM_ROOT，否则为 "+defaultRootDir()+"）")
+	fs.BoolVar(&verbose, "verbose", verbose, "输出详细的调试信息")
+	fs.BoolVar(&verbose, "v", verbose, "--verbose 的简写")
+	fs.BoolVar(&quiet, "quiet", quiet, "只输出错误信息")
+	fs.BoolVar(&quiet, "q", quiet, "--quiet 的简写")
+	fs.BoolVar(&jsonOutput, "json", jsonOutput, "以 JSON 格式输出结果")
+	fs.BoolVar(&offline, "offline", offline, "离线模式：不访问网络，只使用下载缓存和本地镜像")
+}
+
+// 解析参数，允许参数与位置参数交错出现，"--" 之后的内容全部视为位置参数
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// 查找子命令
+func findCommand(list []*command, name string) *command {
+	for _, c := range list {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// 命令行入口，返回退出码
+func runCLI(args []string) int {
+	fs := flag.NewFlagSet("pvm", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addGlobalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printMainUsage(os.Stdout)
+			return exitOK
+		}
+		return reportError(usageErrorf("%v", err))
+	}
+	args = fs.Args()
+
+	if len(args) == 0 {
+		// 只有交互式地直接运行 pvm 时才显示欢迎信息
+		if isTerminal(os.Stdout) && !quiet && !jsonOutput {
+			fmt.Println("PVM - PHP 版本管理器")
+			fmt.Println("===================")
+		}
+		printMainUsage(os.Stdout)
+		return exitOK
+	}
+
+	// 补全脚本调用的内部命令，参数格式与普通命令不同
+	if args[0] == completeCommandName {
+		return runComplete(args[1:])
+	}
+
+	cmd := findCommand(commands, args[0])
+	if cmd == nil {
+		printMainUsage(os.Stderr)
+		return reportError(usageErrorf("未知命令: %s", args[0]))
+	}
+	return reportError(runCommand(cmd, "pvm "+cmd.name, args[1:]))
+}
+
+// 解析参数并执行子命令
+func runCommand(cmd *command, path string, args []string) error {
+	// 带有下级命令的命令组，直接按下一个参数分发
+	if len(cmd.subcommands) > 0 && cmd.run == nil {
+		if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			printCommandUsage(os.Stdout, cmd, path, nil)
+			return nil
+		}
+		sub := findCommand(cmd.subcommands, args[0])
+		if sub == nil {
+			printCommandUsage(os.Stderr, cmd, path, nil)
+			return usageErrorf("未知命令: %s %s", path, args[0])
+		}
+		return runCommand(sub, path+" "+sub.name, args[1:])
+	}
+	// 本身可以执行的命令也可以带有下级命令，例如 audit 和 audit update
+	if len(cmd.subcommands) > 0 && len(args) > 0 {
+		if sub := findCommand(cmd.subcommands, args[0]); sub != nil {
+			return runCommand(sub, path+" "+sub.name, args[1:])
+		}
+	}
+
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addGlobalFlags(fs)
+	if cmd.setup != nil {
+		cmd.setup(fs)
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printCommandUsage(os.Stdout, cmd, path, fs)
+			return nil
+		}
+		printCommandUsage(os.Stderr, cmd, path, fs)
+		return usageErrorf("%v", err)
+	}
+	if quiet && verbose {
+		return usageErrorf("--quiet 与 --verbose 不能同时使用")
+	}
+	if err := initRoot(); err != nil {
+		return err
+	}
+	if err := loadSettings(); err != nil {
+		return err
+	}
+
+	// Ctrl+C 时取消正在进行的下载、解压和复制，并回滚到执行命令前的状态
+	ctx, stop := interruptContext()
+	defer stop()
+	commandCtx = ctx
+	return cmd.run(positional)
+}
+
+// 输出错误信息并返回对应的退出码
+func reportError(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	code := exitCodeOf(err)
+	var ce *codedError
+	if jsonOutput && errors.As(err, &ce) && ce.reported {
+		return code
+	}
+	if jsonOutput {
+		printJSON(map[string]interface{}{"error": err.Error(), "exit_code": code})
+	} else {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+	}
+	return code
+}
+
+// 输出总体帮助
+func printMainUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: pvm [全局参数] <命令> [参数]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "命令:")
+	for _, c := range commands {
+		if !c.hidden {
+			fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "全局参数:")
+	fs := flag.NewFlagSet("pvm", flag.ContinueOnError)
+	addGlobalFlags(fs)
+	printFlags(w, fs)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "退出码:")
+	fmt.Fprintln(w, "  0  成功")
+	fmt.Fprintln(w, "  1  一般错误")
+	fmt.Fprintln(w, "  2  命令行用法错误")
+	fmt.Fprintln(w, "  3  找不到指定的版本")
+	fmt.Fprintln(w, "  4  网络或下载失败")
+	fmt.Fprintln(w, "  5  用户取消了操作")
+	fmt.Fprintln(w, "  6  检查未通过（outdated 发现可以更新的版本，audit 发现有漏洞的版本）")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "使用 \"pvm help <命令>\" 或 \"pvm <命令> --help\" 查看命令的详细说明")
+}
+
+// 输出单个命令的帮助
+func printCommandUsage(w io.Writer, cmd *command, path string, fs *flag.FlagSet) {
+	usage := path
+	if len(cmd.subcommands) > 0 && cmd.run == nil {
+		usage += " <子命令>"
+	} else {
+		usage += " [参数]"
+	}
+	if cmd.args != "" {
+		usage += " " + cmd.args
+	}
+	fmt.Fprintf(w, "用法: %s\n\n", usage)
+	fmt.Fprintln(w, cmd.summary)
+	if cmd.description != "" {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, strings.TrimSpace(cmd.description))
+	}
+	if len(cmd.subcommands) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "子命令:")
+		for _, c := range cmd.subcommands {
+			if !c.hidden {
+				fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+			}
+		}
+	}
+	if fs == nil {
+		return
+	}
+	// 先列出命令专属参数，再列出全局参数
+	global := flag.NewFlagSet("", flag.ContinueOnError)
+	addGlobalFlags(global)
+	own := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.VisitAll(func(f *flag.Flag) {
+		if global.Lookup(f.Name) == nil {
+			own.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	if hasFlags(own) {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "参数:")
+		printFlags(w, own)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "全局参数:")
+	printFlags(w, global)
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+// 按名称顺序输出参数说明
+func printFlags(w io.Writer, fs *flag.FlagSet) {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	for _, f := range flags {
+		name := "--" + f.Name
+		if len(f.Name) == 1 {
+			name = "-" + f.Name
+		}
+		if typ, _ := flag.UnquoteUsage(f); typ != "" {
+			name += " " + typ
+		}
+		fmt.Fprintf(w, "  %-24s %s\n", name, f.Usage)
+	}
+}
+
+// 要求位置参数个数在 [min, max] 之间，max < 0 表示不限
+func requireArgs(args []string, min, max int, hint string) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return usageErrorf("%s", hint)
+	}
+	return nil
+}
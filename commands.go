@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+func init() {
+	commands = []*command{
+		{
+			name:    "list",
+			summary: "列出所有已安装的版本",
+			run: func(args []string) error {
+				if err := requireArgs(args, 0, 0, "list 命令不接受参数"); err != nil {
+					return err
+				}
+				return listVersions()
+			},
+		},
+		newInstallCommand(),
+		{
+			name:        "use",
+			args:        "<版本>",
+			summary:     "切换到指定版本",
+			completeArg: completeInstalledVersions,
+			description: `
+pvm use - 返回上一次切换前使用的版本。
+将指定版本复制到 php_home 目录（Linux 和 macOS 上为符号链接），并确保 php_home 位于 PATH 中。
+默认只修改当前用户的 PATH，不需要管理员权限；--scope system 或 pvm config set scope system
+修改所有用户的 PATH。Windows 上系统 PATH 排在用户 PATH 之前，其中有其他 PHP 时会给出警告。
+切换后运行 php_home 中的 php -v 检查版本，无法运行或版本不一致时自动恢复到切换前的版本。`,
+			setup: func(fs *flag.FlagSet) {
+				fs.BoolVar(&allowEOL, "allow-eol", false, "eol_policy 为 refuse 时仍然切换到已停止维护的版本")
+				fs.Var(scopeFlag{&scopeOverride}, "scope", "修改的 PATH: `user`（当前用户）或 system（所有用户），默认取 scope 设置")
+				fs.BoolVar(&verifyModules, "modules", false, "切换后同时运行 php -m，扩展无法加载时恢复原来的版本")
+				busyFlag(fs)
+			},
+			run: func(args []string) error {
+				if err := requireArgs(args, 1, 1, "请指定要使用的版本，例如：pvm use 7.4\n您可以使用 pvm list 命令查看已安装的版本"); err != nil {
+					return err
+				}
+				if args[0] == "-" {
+					previous, err := previousVersion()
+					if err != nil {
+						return err
+					}
+					infof("返回上一个版本 %s\n", previous)
+					switchSource = "use -"
+					return useVersion(commandCtx, previous)
+				}
+				return useVersion(commandCtx, args[0])
+			},
+		},
+		{
+			name:        "uninstall",
+			args:        "<版本>",
+			summary:     "卸载已安装的版本",
+			completeArg: completeInstalledVersions,
+			setup:       busyFlag,
+			run: func(args []string) error {
+				if err := requireArgs(args, 1, 1, "请指定要卸载的版本，例如：pvm uninstall 7.4"); err != nil {
+					return err
+				}
+				return uninstallVersion(commandCtx, args[0])
+			},
+		},
+		{
+			name:    "current",
+			summary: "显示当前使用的版本",
+			run: func(args []string) error {
+				if err := requireArgs(args, 0, 0, "current 命令不接受参数"); err != nil {
+					return err
+				}
+				return showCurrent()
+			},
+		},
+		newHistoryCommand(),
+		newEnvCommand(),
+		newPathCommand(),
+		newDeactivateCommand(),
+		newImplodeCommand(),
+		newSetenvCommand(),
+		{
+			name:    "check",
+			summary: "查看PHP官网上可用的版本",
+			run: func(args []string) error {
+				if err := requireArgs(args, 0, 0, "check 命令不接受参数"); err != nil {
+					return err
+				}
+				return checkAvailableVersions(commandCtx)
+			},
+		},
+		newLsRemoteCommand(),
+		newOutdatedCommand(),
+		newEOLCommand(),
+		newAuditCommand(),
+		newCacheCommand(),
+		newMirrorCommand(),
+		newConfigCommand(),
+		newDoctorCommand(),
+		newCompletionCommand(),
+		newHelpCommand(),
+	}
+}
+
+func newInstallCommand() *command {
+	var fromFile, fromDir string
+	var jobs int
+	var fromSource bool
+	return &command{
+		name:        "install",
+		args:        "[版本...]",
+		summary:     "安装指定版本",
+		completeArg: completeRemoteVersions,
+		description: `
+从 PHP 官方 Windows 仓库下载并安装指定版本，安装完成后自动切换到该版本。
+版本可以是主次版本号（如 8.2，安装该系列的最新版本）或完整版本号（如 8.2.15）。
+
+可以同时指定多个版本，例如 pvm install 7.4 8.1 8.2 8.3。多个版本会并发下载，
+依次解压和登记，一个版本失败不影响其他版本，最后输出每个版本的结果，不会自动切换版本。
+
+使用 --from-file 或 --from-dir 可以从本地压缩包或已解压的目录安装，不需要网络。
+版本、线程安全类型、架构和编译器从文件名识别，无法识别时运行其中的 php -v。
+此时指定的版本作为 use 等命令使用的名称，未指定时使用主次版本号。
+
+预发布版本从 qa_url 设置的目录（默认为官方 QA 目录）下载，例如 pvm install 8.4.0RC2；
+开发快照从 snapshot_url 设置的目录下载，例如 pvm install 8.4-dev。
+8.4 这样的版本号只会选择正式版本，除非使用 --pre。
+
+在 Linux 和 macOS 上可以使用 --source 从 php-src 源码编译，版本后面用 +<名称> 指定变体，
+例如 pvm install --source 8.3.4 +intl +pgsql +sodium。源码包从 source_url 设置的目录下载，
+也可以用 --from-file 指定本地的 php-<版本>.tar.gz。每个变体对应一组 configure 参数，
+可以用 pvm config set variant.<名称> -- "<参数>" 添加或覆盖（参数以 - 开头，需要放在 -- 之后）。编译日志保存在 <根目录>/logs 中。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&fromFile, "from-file", "", "从本地压缩包安装（zip 或 tar.gz，使用 --source 时为 php-src 源码包）")
+			fs.StringVar(&fromDir, "from-dir", "", "从已解压的 PHP 目录安装")
+			fs.IntVar(&jobs, "jobs", defaultInstallJobs, "同时安装多个版本时，同时下载的版本数")
+			fs.IntVar(&jobs, "j", defaultInstallJobs, "--jobs 的简写")
+			fs.BoolVar(&allowEOL, "allow-eol", false, "eol_policy 为 refuse 时仍然安装已停止维护的版本")
+			fs.Var(scopeFlag{&scopeOverride}, "scope", "安装后切换版本时修改的 PATH: `user` 或 system，默认取 scope 设置")
+			fs.BoolVar(&fromSource, "source", false, "从 php-src 源码编译（仅 Linux 和 macOS），用 +<名称> 指定变体")
+			fs.BoolVar(&includePrerelease, "pre", false, "允许选择预发布版本，例如 pvm install --pre 8.4 会在 RC 比正式版本新时安装 RC")
+		},
+		run: func(args []string) error {
+			switchSource = "install"
+			args, variants := splitVariants(args)
+			if len(variants) > 0 && !fromSource {
+				return usageErrorf("+%s 等变体只能与 --source 一起使用", variants[0])
+			}
+			switch {
+			case fromSource:
+				if fromDir != "" {
+					return usageErrorf("--source 不能与 --from-dir 一起使用")
+				}
+				min := 1
+				if fromFile != "" {
+					min = 0
+				}
+				if err := requireArgs(args, min, 1, "请指定一个完整版本号，例如：pvm install --source 8.3.4 +intl"); err != nil {
+					return err
+				}
+				version := ""
+				if len(args) == 1 {
+					version = args[0]
+				}
+				return installFromSource(commandCtx, version, fromFile, variants)
+			case fromFile != "" && fromDir != "":
+				return usageErrorf("--from-file 和 --from-dir 不能同时使用")
+			case fromFile != "" || fromDir != "":
+				if err := requireArgs(args, 0, 1, "最多只能指定一个版本"); err != nil {
+					return err
+				}
+				key := ""
+				if len(args) == 1 {
+					key = args[0]
+				}
+				if fromFile != "" {
+					return installFromFile(commandCtx, key, fromFile)
+				}
+				return installFromDir(commandCtx, key, fromDir)
+			}
+			if err := requireArgs(args, 1, -1, "请指定要安装的版本，例如：pvm install 7.4\n您可以使用 pvm check 命令查看可用的版本"); err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				return installVersions(commandCtx, args, jobs)
+			}
+			return installVersion(commandCtx, args[0])
+		},
+	}
+}
+
+// help 命令需要引用命令表本身，单独构造以避免初始化循环
+func newHelpCommand() *command {
+	return &command{
+		name:        "help",
+		args:        "[命令]",
+		summary:     "显示帮助信息",
+		completeArg: completeCommandNames,
+		run: func(args []string) error {
+			if len(args) == 0 {
+				printMainUsage(os.Stdout)
+				return nil
+			}
+			list, path := commands, "pvm"
+			var cmd *command
+			for _, name := range args {
+				cmd = findCommand(list, name)
+				if cmd == nil {
+					return usageErrorf("未知命令: %s %s", path, name)
+				}
+				list, path = cmd.subcommands, path+" "+name
+			}
+			fs := flag.NewFlagSet(path, flag.ContinueOnError)
+			addGlobalFlags(fs)
+			if cmd.setup != nil {
+				cmd.setup(fs)
+			}
+			printCommandUsage(os.Stdout, cmd, path, fs)
+			return nil
+		},
+	}
+}
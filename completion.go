@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 补全脚本回调的内部命令名
+const completeCommandName = "__complete"
+
+// 支持生成补全脚本的 shell
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+func newCompletionCommand() *command {
+	return &command{
+		name:    "completion",
+		args:    "<bash|zsh|fish|powershell>",
+		summary: "生成 shell 补全脚本",
+		description: `
+输出指定 shell 的补全脚本，补全内容包括子命令、参数、已安装的版本（use）以及
+最近一次查询到的远程版本（install）。加载方法：
+
+  bash:        source <(pvm completion bash)
+  zsh:         source <(pvm completion zsh)
+  fish:        pvm completion fish | source
+  powershell:  pvm completion powershell | Out-String | Invoke-Expression
+
+写入对应 shell 的配置文件即可永久生效。`,
+		completeArg: func(args []string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+			return completionShells
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 1, 1, "请指定 shell，可选: "+strings.Join(completionShells, ", ")); err != nil {
+				return err
+			}
+			script, ok := completionScripts[args[0]]
+			if !ok {
+				return usageErrorf("不支持的 shell: %s，可选: %s", args[0], strings.Join(completionShells, ", "))
+			}
+			fmt.Print(script)
+			return nil
+		},
+	}
+}
+
+// 各 shell 的补全脚本。脚本只负责收集命令行，候选值由 pvm __complete 计算，
+// 当前单词通过 --cur= 传递，避免部分 shell 丢弃空参数
+var completionScripts = map[string]string{
+	"bash": `# pvm bash 补全
+_pvm_completion() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local IFS=$'\n'
+    COMPREPLY=($(pvm __complete "--cur=${cur}" -- "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null))
+}
+complete -o default -F _pvm_completion pvm
+`,
+	"zsh": `#compdef pvm
+# pvm zsh 补全
+_pvm() {
+    local -a candidates
+    candidates=(${(f)"$(pvm __complete "--cur=${words[CURRENT]}" -- "${(@)words[2,CURRENT-1]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+if [ "$funcstack[1]" = "_pvm" ]; then
+    _pvm "$@"
+else
+    compdef _pvm pvm
+fi
+`,
+	"fish": `# pvm fish 补全
+function __pvm_complete
+    set -l tokens (commandline -opc)
+    set -l cur (commandline -ct)
+    pvm __complete "--cur=$cur" -- $tokens[2..-1] 2>/dev/null
+end
+complete -c pvm -f -a '(__pvm_complete)'
+`,
+	"powershell": `# pvm PowerShell 补全
+Register-ArgumentCompleter -Native -CommandName pvm, pvm.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements |
+        Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    & pvm __complete "--cur=$wordToComplete" -- @words 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// 处理 pvm __complete --cur=<当前单词> -- <之前的单词...>
+func runComplete(args []string) int {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "--cur=") {
+		return reportError(usageErrorf("用法: pvm %s --cur=<单词> -- <单词...>", completeCommandName))
+	}
+	cur := strings.TrimPrefix(args[0], "--cur=")
+	words := args[1:]
+	if len(words) > 0 && words[0] == "--" {
+		words = words[1:]
+	}
+	for _, c := range completeWords(words, cur) {
+		fmt.Println(c)
+	}
+	return exitOK
+}
+
+// 根据已输入的单词计算当前单词的候选值
+func completeWords(words []string, cur string) []string {
+	list := commands
+	var cmd *command
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	addGlobalFlags(fs)
+	var positional []string
+	pending := "" // 等待取值的参数名
+
+	for _, w := range words {
+		if pending != "" {
+			// 记录 --root 等全局参数的值
+			fs.Set(pending, w)
+			pending = ""
+			continue
+		}
+		if strings.HasPrefix(w, "-") && w != "-" {
+			name := strings.TrimLeft(w, "-")
+			if i := strings.Index(name, "="); i >= 0 {
+				fs.Set(name[:i], name[i+1:])
+				continue
+			}
+			if f := fs.Lookup(name); f != nil && !isBoolFlag(f) {
+				pending = name
+			}
+			continue
+		}
+		if len(positional) == 0 {
+			if next := findCommand(list, w); next != nil {
+				cmd, list = next, next.subcommands
+				if cmd.setup != nil {
+					cmd.setup(fs)
+				}
+				continue
+			}
+		}
+		positional = append(positional, w)
+	}
+
+	// 上一个单词是需要取值的参数，交给 shell 默认补全（例如文件名）
+	if pending != "" {
+		return nil
+	}
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(cur, "-"):
+		fs.VisitAll(func(f *flag.Flag) {
+			if len(f.Name) > 1 {
+				candidates = append(candidates, "--"+f.Name)
+			}
+		})
+	case cmd == nil || (len(cmd.subcommands) > 0 && len(positional) == 0):
+		for _, c := range list {
+			if !c.hidden {
+				candidates = append(candidates, c.name)
+			}
+		}
+	case cmd.completeArg != nil:
+		if initRoot() == nil && loadSettings() == nil {
+			candidates = cmd.completeArg(positional)
+		}
+	}
+
+	var result []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, cur) {
+			result = append(result, c)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// 已安装的版本，用于 use 等命令的补全
+func completeInstalledVersions(args []string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	m, err := loadManifest()
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for v := range m {
+		list = append(list, v)
+	}
+	return list
+}
+
+// 最近一次查询到的远程版本及其系列号，用于 install 的补全（可以指定多个版本）
+func completeRemoteVersions(args []string) []string {
+	seen := make(map[string]bool)
+	for _, v := range args {
+		seen[v] = true
+	}
+	var list []string
+	for _, v := range loadRemoteVersions() {
+		parts := strings.Split(v, ".")
+		series := parts[0] + "." + parts[1]
+		for _, c := range []string{series, v} {
+			if !seen[c] {
+				seen[c] = true
+				list = append(list, c)
+			}
+		}
+	}
+	return list
+}
+
+// 命令名称，用于 help 的补全
+func completeCommandNames(args []string) []string {
+	list := commands
+	for _, name := range args {
+		cmd := findCommand(list, name)
+		if cmd == nil {
+			return nil
+		}
+		list = cmd.subcommands
+	}
+	var names []string
+	for _, c := range list {
+		if !c.hidden {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pvm 设置，保存在 <根目录>/config.json
+type settings struct {
+	// 按优先级排列的镜像，每个镜像的目录结构与 windows.php.net/downloads/releases/ 相同
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// 网络设置
+	Proxy          string              `json:"proxy,omitempty"`           // 代理地址，未设置时使用 HTTP(S)_PROXY 环境变量
+	CACerts        []string            `json:"ca_certs,omitempty"`        // 额外信任的 CA 证书（PEM 文件）
+	UserAgent      string              `json:"user_agent,omitempty"`      // 请求使用的 User-Agent
+	Timeout        string              `json:"timeout,omitempty"`         // 小请求的总超时，例如 60s
+	ConnectTimeout string              `json:"connect_timeout,omitempty"` // 建立连接的超时，例如 15s
+	Netrc          string              `json:"netrc,omitempty"`           // .netrc 文件路径
+	Auth           map[string]hostAuth `json:"auth,omitempty"`            // 主机 => 认证信息
+	AuthOverHTTP   bool                `json:"auth_over_http,omitempty"`  // 允许通过 http:// 发送认证信息
+
+	IndexTTL string `json:"index_ttl,omitempty"` // 目录页缓存的有效期，例如 1h
+
+	// 支持周期
+	EOLURL    string `json:"eol_url,omitempty"`    // pvm eol update 的数据地址
+	EOLPolicy string `json:"eol_policy,omitempty"` // 停止维护版本的处理方式: warn、refuse 或 ignore
+
+	// 安全公告
+	AdvisoryURL string `json:"advisory_url,omitempty"` // pvm audit update 的数据地址
+
+	// 预发布版本
+	QAURL       string `json:"qa_url,omitempty"`       // alpha、beta、RC 所在的目录
+	SnapshotURL string `json:"snapshot_url,omitempty"` // 开发快照（例如 8.4-dev）所在的目录
+
+	// Linux 等平台上使用的 static-php-cli 静态构建目录
+	StaticURL string `json:"static_url,omitempty"`
+
+	// 从源码编译
+	SourceURL string            `json:"source_url,omitempty"` // php-src 发布包所在的目录
+	Variants  map[string]string `json:"variants,omitempty"`   // 变体名称 => configure 参数
+
+	// pvm use 修改的 PATH：user（默认）或 system
+	Scope string `json:"scope,omitempty"`
+}
+
+// 当前设置，由 loadSettings 读取
+var cfg settings
+
+func settingsPath() string {
+	return filepath.Join(rootDir, "config.json")
+}
+
+// 读取设置文件，文件不存在时使用默认设置
+func loadSettings() error {
+	cfg = settings{}
+	data, err := os.ReadFile(settingsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取设置文件失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("解析设置文件 %s 失败: %v", settingsPath(), err)
+	}
+	return nil
+}
+
+// 保存设置文件
+func saveSettings() error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("保存设置失败: %v", err)
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return fmt.Errorf("创建根目录失败: %v", err)
+	}
+	// 设置中可能有 auth.<host> 的令牌或密码，只允许当前用户读写。
+	// WriteFile 不会修改已有文件的权限，需要单独收紧
+	if err := os.WriteFile(settingsPath(), data, 0600); err != nil {
+		return fmt.Errorf("写入设置文件失败: %v", err)
+	}
+	if err := os.Chmod(settingsPath(), 0600); err != nil {
+		return fmt.Errorf("修改设置文件权限失败: %v", err)
+	}
+	return nil
+}
+
+// 可以通过 pvm config 读写的设置项
+type settingKey struct {
+	name string
+	help string
+	get  func() string
+	set  func(v string) error // v 为空字符串表示恢复默认值
+}
+
+var settingKeys = []settingKey{
+	{
+		name: "proxy",
+		help: "HTTP(S) 代理地址，例如 http://proxy.example.com:8080",
+		get:  func() string { return cfg.Proxy },
+		set: func(v string) error {
+			if v != "" {
+				if u, err := url.Parse(v); err != nil || u.Host == "" {
+					return fmt.Errorf("无效的代理地址: %s", v)
+				}
+			}
+			cfg.Proxy = v
+			return nil
+		},
+	},
+	{
+		name: "ca_certs",
+		help: "额外信任的 CA 证书文件，多个文件用逗号分隔",
+		get:  func() string { return strings.Join(cfg.CACerts, ",") },
+		set: func(v string) error {
+			cfg.CACerts = nil
+			for _, f := range strings.Split(v, ",") {
+				if f = strings.TrimSpace(f); f == "" {
+					continue
+				}
+				abs, err := filepath.Abs(f)
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stat(abs); err != nil {
+					return fmt.Errorf("找不到证书文件: %s", abs)
+				}
+				cfg.CACerts = append(cfg.CACerts, abs)
+			}
+			return nil
+		},
+	},
+	{
+		name: "user_agent",
+		help: "请求使用的 User-Agent，默认为 " + defaultUserAgent,
+		get:  func() string { return cfg.UserAgent },
+		set:  func(v string) error { cfg.UserAgent = v; return nil },
+	},
+	{
+		name: "timeout",
+		help: "目录页等小请求的总超时，默认为 " + defaultRequestTimeout.String(),
+		get:  func() string { return cfg.Timeout },
+		set:  durationSetter(&cfg.Timeout),
+	},
+	{
+		name: "connect_timeout",
+		help: "建立连接的超时，默认为 " + defaultConnectTimeout.String(),
+		get:  func() string { return cfg.ConnectTimeout },
+		set:  durationSetter(&cfg.ConnectTimeout),
+	},
+	{
+		name: "netrc",
+		help: ".netrc 文件路径，默认为 NETRC 环境变量或用户目录下的 .netrc（Windows 为 _netrc）",
+		get:  func() string { return cfg.Netrc },
+		set:  func(v string) error { cfg.Netrc = v; return nil },
+	},
+	{
+		name: "auth_over_http",
+		help: "设为 true 时也通过 http:// 发送认证信息，默认只在 https 请求中发送",
+		get: func() string {
+			if cfg.AuthOverHTTP {
+				return "true"
+			}
+			return ""
+		},
+		set: func(v string) error {
+			if v == "" {
+				cfg.AuthOverHTTP = false
+				return nil
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("无效的取值: %s，可选 true 或 false", v)
+			}
+			cfg.AuthOverHTTP = b
+			return nil
+		},
+	},
+	{
+		name: "index_ttl",
+		help: "版本目录页缓存的有效期，默认为 " + defaultIndexTTL.String(),
+		get:  func() string { return cfg.IndexTTL },
+		set:  durationSetter(&cfg.IndexTTL),
+	},
+	{
+		name: "eol_url",
+		help: "pvm eol update 使用的支持周期数据地址，默认为 " + defaultEOLURL,
+		get:  func() string { return cfg.EOLURL },
+		set:  func(v string) error { cfg.EOLURL = v; return nil },
+	},
+	{
+		name: "eol_policy",
+		help: "安装或切换到已停止维护的版本时: warn（警告，默认）、refuse（拒绝）或 ignore（不提示）",
+		get:  func() string { return cfg.EOLPolicy },
+		set: func(v string) error {
+			switch v {
+			case "", eolPolicyWarn, eolPolicyRefuse, eolPolicyIgnore:
+				cfg.EOLPolicy = v
+				return nil
+			}
+			return fmt.Errorf("无效的 eol_policy: %s，可选 warn、refuse 或 ignore", v)
+		},
+	},
+	{
+		name: "advisory_url",
+		help: "pvm audit update 使用的安全公告数据地址或本地文件",
+		get:  func() string { return cfg.AdvisoryURL },
+		set:  func(v string) error { cfg.AdvisoryURL = v; return nil },
+	},
+	{
+		name: "qa_url",
+		help: "预发布版本（alpha、beta、RC）所在的目录，默认为 " + defaultQAURL,
+		get:  func() string { return cfg.QAURL },
+		set:  dirURLSetter(&cfg.QAURL),
+	},
+	{
+		name: "snapshot_url",
+		help: "开发快照所在的目录，文件名形如 php-8.4-dev-nts-Win32-vs17-x64.zip，没有默认值",
+		get:  func() string { return cfg.SnapshotURL },
+		set:  dirURLSetter(&cfg.SnapshotURL),
+	},
+	{
+		name: "static_url",
+		help: "Linux 等平台上下载 static-php-cli 静态构建的目录，默认为 " + defaultStaticURL,
+		get:  func() string { return cfg.StaticURL },
+		set:  dirURLSetter(&cfg.StaticURL),
+	},
+	{
+		name: "source_url",
+		help: "pvm install --source 下载 php-src 发布包的目录，默认为 " + defaultSourceURL,
+		get:  func() string { return cfg.SourceURL },
+		set:  dirURLSetter(&cfg.SourceURL),
+	},
+	{
+		name: "scope",
+		help: "pvm use 修改的 PATH: user（当前用户，默认，不需要管理员权限）或 system（所有用户）",
+		get:  func() string { return cfg.Scope },
+		set: func(v string) error {
+			if v != "" {
+				if _, err := parseScope(v); err != nil {
+					return err
+				}
+			}
+			cfg.Scope = v
+			return nil
+		},
+	},
+}
+
+func durationSetter(p *string) func(string) error {
+	return func(v string) error {
+		if v != "" {
+			if _, err := time.ParseDuration(v); err != nil {
+				return fmt.Errorf("无效的时长: %s", v)
+			}
+		}
+		*p = v
+		return nil
+	}
+}
+
+func findSettingKey(name string) *settingKey {
+	for i := range settingKeys {
+		if settingKeys[i].name == name {
+			return &settingKeys[i]
+		}
+	}
+	return nil
+}
+
+// 解析认证设置的值：bearer:<令牌>、bearer-env:<环境变量>、basic:<用户>:<密码>、basic-env:<用户>:<环境变量>
+func parseAuthValue(v string) (hostAuth, error) {
+	kind, rest, _ := strings.Cut(v, ":")
+	switch kind {
+	case "bearer":
+		return hostAuth{Type: "bearer", Token: rest}, nil
+	case "bearer-env":
+		return hostAuth{Type: "bearer", TokenEnv: rest}, nil
+	case "basic", "basic-env":
+		user, secret, ok := strings.Cut(rest, ":")
+		if !ok {
+			break
+		}
+		if kind == "basic" {
+			return hostAuth{Type: "basic", Username: user, Password: secret}, nil
+		}
+		return hostAuth{Type: "basic", Username: user, PasswordEnv: secret}, nil
+	}
+	return hostAuth{}, fmt.Errorf("无效的认证设置 %q，格式为 bearer:<令牌>、bearer-env:<环境变量>、basic:<用户>:<密码> 或 basic-env:<用户>:<环境变量>", v)
+}
+
+// 显示认证设置，隐藏令牌和密码
+func formatAuth(a hostAuth) string {
+	switch {
+	case a.Type == "bearer" && a.TokenEnv != "":
+		return "bearer-env:" + a.TokenEnv
+	case a.Type == "bearer":
+		return "bearer:******"
+	case a.PasswordEnv != "":
+		return "basic-env:" + a.Username + ":" + a.PasswordEnv
+	default:
+		return "basic:" + a.Username + ":******"
+	}
+}
+
+// 所有设置项的当前值
+func settingValues() map[string]string {
+	values := make(map[string]string)
+	for _, k := range settingKeys {
+		values[k.name] = k.get()
+	}
+	for host, a := range cfg.Auth {
+		values["auth."+host] = formatAuth(a)
+	}
+	for name, flags := range cfg.Variants {
+		values["variant."+name] = flags
+	}
+	return values
+}
+
+func newConfigCommand() *command {
+	settingNames := func(args []string) []string {
+		if len(args) > 0 {
+			return nil
+		}
+		var names []string
+		for _, k := range settingKeys {
+			names = append(names, k.name)
+		}
+		for host := range cfg.Auth {
+			names = append(names, "auth."+host)
+		}
+		for name := range cfg.Variants {
+			names = append(names, "variant."+name)
+		}
+		return names
+	}
+
+	var keyHelp strings.Builder
+	for _, k := range settingKeys {
+		fmt.Fprintf(&keyHelp, "  %-16s %s\n", k.name, k.help)
+	}
+	fmt.Fprintf(&keyHelp, "  %-16s %s\n", "auth.<主机>", "该主机的认证信息: bearer:<令牌>、bearer-env:<环境变量>、basic:<用户>:<密码>、basic-env:<用户>:<环境变量>")
+	fmt.Fprintf(&keyHelp, "  %-16s %s\n", "variant.<名称>", "pvm install --source 的 +<名称> 变体使用的 configure 参数，可以覆盖内置变体")
+
+	return &command{
+		name:    "config",
+		summary: "查看和修改设置",
+		description: "设置保存在 <根目录>/config.json 中。可用的设置项:\n\n" + keyHelp.String() +
+			"\n未在 auth 中配置的主机会使用 .netrc 中的用户名和密码。",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "列出所有设置",
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "config list 命令不接受参数"); err != nil {
+						return err
+					}
+					values := settingValues()
+					if jsonOutput {
+						return printJSON(values)
+					}
+					names := make([]string, 0, len(values))
+					for name := range values {
+						names = append(names, name)
+					}
+					sort.Strings(names)
+					for _, name := range names {
+						infof("  %s = %s\n", name, values[name])
+					}
+					return nil
+				},
+			},
+			{
+				name:        "get",
+				args:        "<设置项>",
+				summary:     "显示一项设置",
+				completeArg: settingNames,
+				run: func(args []string) error {
+					if err := requireArgs(args, 1, 1, "请指定设置项，例如：pvm config get proxy"); err != nil {
+						return err
+					}
+					v, ok := settingValues()[args[0]]
+					if !ok && !strings.HasPrefix(args[0], "auth.") && !strings.HasPrefix(args[0], "variant.") {
+						return usageErrorf("未知的设置项: %s", args[0])
+					}
+					if jsonOutput {
+						return printJSON(map[string]string{args[0]: v})
+					}
+					fmt.Println(v)
+					return nil
+				},
+			},
+			{
+				name:        "set",
+				args:        "<设置项> <值>",
+				summary:     "修改一项设置",
+				completeArg: settingNames,
+				run: func(args []string) error {
+					if err := requireArgs(args, 2, 2, "请指定设置项和值，例如：pvm config set proxy http://proxy.example.com:8080"); err != nil {
+						return err
+					}
+					if err := setSetting(args[0], args[1]); err != nil {
+						return err
+					}
+					if err := saveSettings(); err != nil {
+						return err
+					}
+					infof("已设置 %s\n", args[0])
+					return nil
+				},
+			},
+			{
+				name:        "unset",
+				args:        "<设置项>",
+				summary:     "恢复一项设置的默认值",
+				completeArg: settingNames,
+				run: func(args []string) error {
+					if err := requireArgs(args, 1, 1, "请指定设置项，例如：pvm config unset proxy"); err != nil {
+						return err
+					}
+					if err := setSetting(args[0], ""); err != nil {
+						return err
+					}
+					if err := saveSettings(); err != nil {
+						return err
+					}
+					infof("已恢复 %s 的默认值\n", args[0])
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// 修改一项设置，值为空字符串表示恢复默认值
+func setSetting(name, value string) error {
+	if host, ok := strings.CutPrefix(name, "auth."); ok {
+		if host == "" {
+			return usageErrorf("请指定主机，例如 auth.mirror.example.com")
+		}
+		if value == "" {
+			delete(cfg.Auth, host)
+			return nil
+		}
+		a, err := parseAuthValue(value)
+		if err != nil {
+			return withExit(exitUsage, err)
+		}
+		if cfg.Auth == nil {
+			cfg.Auth = make(map[string]hostAuth)
+		}
+		cfg.Auth[host] = a
+		return nil
+	}
+	if variant, ok := strings.CutPrefix(name, "variant."); ok {
+		if err := setVariant(variant, value); err != nil {
+			return withExit(exitUsage, err)
+		}
+		return nil
+	}
+	k := findSettingKey(name)
+	if k == nil {
+		return usageErrorf("未知的设置项: %s", name)
+	}
+	if err := k.set(value); err != nil {
+		return withExit(exitUsage, err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 第一次修改某个作用范围的 PATH 之前记录的原始值，pvm implode 据此恢复
+type envSnapshot struct {
+	Recorded time.Time `json:"recorded"`
+	PATH     string    `json:"path"`
+}
+
+func snapshotPath() string {
+	return filepath.Join(rootDir, "env-snapshot.json")
+}
+
+func loadSnapshots() (map[envScope]envSnapshot, error) {
+	snapshots := make(map[envScope]envSnapshot)
+	data, err := os.ReadFile(snapshotPath())
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取环境快照失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("解析环境快照 %s 失败: %v", snapshotPath(), err)
+	}
+	return snapshots, nil
+}
+
+// 记录作用范围的原始 PATH，已经记录过时不做修改
+func recordSnapshot(scope envScope, value string) error {
+	snapshots, err := loadSnapshots()
+	if err != nil {
+		return err
+	}
+	if _, ok := snapshots[scope]; ok {
+		return nil
+	}
+	snapshots[scope] = envSnapshot{Recorded: time.Now(), PATH: value}
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return fmt.Errorf("创建根目录失败: %v", err)
+	}
+	if err := os.WriteFile(snapshotPath(), data, 0644); err != nil {
+		return fmt.Errorf("保存环境快照失败: %v", err)
+	}
+	debugf("已记录 %s 的原始 PATH\n", scope)
+	return nil
+}
+
+// 修改 PATH，第一次修改前先记录原始值
+func setPath(env EnvManager, scope envScope, value string) error {
+	old, err := env.Get(scope, "PATH")
+	if err != nil {
+		return err
+	}
+	if err := recordSnapshot(scope, old); err != nil {
+		return err
+	}
+	return env.Set(scope, "PATH", value)
+}
+
+// pvm 加入 PATH 的目录，包括以前版本使用的 php_home
+func isManagedEntry(p string) bool {
+	dir := filepath.Clean(expandEnvRefs(p))
+	return samePath(dir, managedPathDir()) || samePath(dir, phpHomePath())
+}
+
+// PATH 中是否有 pvm 加入的目录
+func hasManaged(value string) bool {
+	for _, p := range filepath.SplitList(value) {
+		if p != "" && isManagedEntry(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉 PATH 中 pvm 加入的目录
+func withoutManaged(value string) []string {
+	var kept []string
+	for _, p := range filepath.SplitList(value) {
+		if p != "" && !isManagedEntry(p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// 从用户和系统 PATH 中删除 pvm 的目录，并取消当前版本
+func deactivate(ctx context.Context, env EnvManager) error {
+	// 先确认 php_home 没有被占用，再修改 PATH，以免只完成一半
+	if err := ensureNotBusy(ctx, phpHomePath()); err != nil {
+		return err
+	}
+	failed := 0
+	for _, scope := range []envScope{scopeUser, scopeSystem} {
+		value, err := env.Get(scope, "PATH")
+		if err != nil {
+			warnf("读取 %s 中的 PATH 失败: %v\n", env.Location(scope), err)
+			failed++
+			continue
+		}
+		// 只比较 pvm 的目录，末尾的分号等空项不算修改，以免没有必要地重写（系统 PATH 还需要管理员权限）
+		if !hasManaged(value) {
+			debugf("%s 中的 PATH 没有 pvm 的目录\n", env.Location(scope))
+			continue
+		}
+		kept := withoutManaged(value)
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		if len(kept) == 0 {
+			err = env.Delete(scope, "PATH")
+		} else {
+			err = env.Set(scope, "PATH", strings.Join(kept, string(os.PathListSeparator)))
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
+			warnf("更新 %s 中的 PATH 失败: %v\n", env.Location(scope), err)
+			failed++
+			continue
+		}
+		infof("已从 %s 的 PATH 中删除 pvm 的目录\n", env.Location(scope))
+	}
+
+	if err := clearActive(); err != nil {
+		return err
+	}
+	infof("已取消当前版本，新开的终端不再使用 pvm 管理的 PHP\n")
+	if failed > 0 {
+		return fmt.Errorf("%d 个 PATH 没有更新，系统 PATH 需要管理员权限", failed)
+	}
+	return nil
+}
+
+// 删除 php_home，之后 pvm current 显示没有当前版本
+func clearActive() error {
+	phpHomeDir := phpHomePath()
+	info, err := os.Lstat(phpHomeDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		err = os.Remove(phpHomeDir)
+	} else {
+		err = os.RemoveAll(phpHomeDir)
+	}
+	if err != nil {
+		return fmt.Errorf("删除 php_home 失败: %v", err)
+	}
+	return nil
+}
+
+// 按快照恢复一个作用范围的 PATH：快照中的项加上之后由其他程序加入的项，去掉 pvm 的目录
+func restoreSnapshot(ctx context.Context, env EnvManager, scope envScope, snap envSnapshot, yes bool) error {
+	value, err := env.Get(scope, "PATH")
+	if err != nil {
+		return fmt.Errorf("读取 %s 中的 PATH 失败: %v", env.Location(scope), err)
+	}
+	restored := withoutManaged(snap.PATH)
+	newValue := strings.Join(restored, string(os.PathListSeparator))
+	for _, p := range withoutManaged(value) {
+		if !pathContains(newValue, p) {
+			restored = append(restored, p)
+			newValue = strings.Join(restored, string(os.PathListSeparator))
+		}
+	}
+	if newValue == value {
+		return nil
+	}
+	infof("%s 中的 PATH（恢复到 %s 记录的状态）:\n", env.Location(scope), snap.Recorded.Format("2006-01-02 15:04"))
+	printPathDiff(analyzePath(value, managedPathDir()), restored)
+	if !yes && !confirm("是否恢复？") {
+		return errCanceled
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if newValue == "" {
+		return env.Delete(scope, "PATH")
+	}
+	return env.Set(scope, "PATH", newValue)
+}
+
+// 删除 pvm 的所有数据，并把 PATH 恢复到使用 pvm 之前的状态
+func implode(ctx context.Context, env EnvManager, yes bool) error {
+	targets := []string{phpsPath(), phpHomePath(), cachePath(), filepath.Join(rootDir, "logs"), tempPath(), settingsPath(), historyPath()}
+	infof("将删除以下内容:\n")
+	for _, t := range targets {
+		if _, err := os.Lstat(t); err == nil {
+			infof("  %s\n", t)
+		}
+	}
+	if !yes && !confirm("pvm 安装的所有 PHP 版本、缓存和设置都会被删除，是否继续？") {
+		return errCanceled
+	}
+	if err := ensureNotBusy(ctx, phpsPath(), phpHomePath()); err != nil {
+		return err
+	}
+
+	snapshots, err := loadSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, scope := range []envScope{scopeUser, scopeSystem} {
+		snap, ok := snapshots[scope]
+		if !ok {
+			continue
+		}
+		if err := restoreSnapshot(ctx, env, scope, snap, yes); err != nil {
+			return err
+		}
+	}
+	// 没有快照的作用范围只删除 pvm 的目录
+	if err := deactivate(ctx, env); err != nil {
+		return err
+	}
+
+	cleanTempArtifacts(0)
+	for _, t := range append(targets, snapshotPath()) {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		if err := os.RemoveAll(t); err != nil {
+			return fmt.Errorf("删除 %s 失败: %v", t, err)
+		}
+		debugf("已删除 %s\n", t)
+	}
+	// 根目录中没有其他文件时一起删除
+	os.Remove(rootDir)
+	infof("pvm 的数据已全部删除\n")
+	return nil
+}
+
+func newDeactivateCommand() *command {
+	return &command{
+		name:    "deactivate",
+		summary: "从 PATH 中删除 pvm 的目录并取消当前版本",
+		description: `
+从用户和系统 PATH 中删除 pvm 加入的目录（Linux 上为 shell 配置文件中的区块），并删除 php_home。
+已安装的版本保留，之后可以再用 pvm use 切换。`,
+		setup: busyFlag,
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "deactivate 命令不接受参数"); err != nil {
+				return err
+			}
+			return deactivate(commandCtx, newEnvManager())
+		},
+	}
+}
+
+func newImplodeCommand() *command {
+	var yes bool
+	return &command{
+		name:    "implode",
+		summary: "删除 pvm 的所有数据并恢复使用 pvm 之前的 PATH",
+		description: `
+把用户和系统 PATH 恢复到 pvm 第一次修改之前记录的状态（之后由其他程序加入的项会保留），
+然后删除 phps、php_home、下载缓存、编译日志、临时文件和设置。pvm 程序本身不会被删除。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.BoolVar(&yes, "yes", false, "不要求确认，直接删除")
+			fs.BoolVar(&yes, "y", false, "--yes 的简写")
+			busyFlag(fs)
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "implode 命令不接受参数"); err != nil {
+				return err
+			}
+			return implode(commandCtx, newEnvManager(), yes)
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWithoutManaged(t *testing.T) {
+	withTestRoot(t)
+	managed := managedPathDir()
+	other := filepath.Join(rootDir, "other")
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"only pvm", managed, nil},
+		{"removes pvm", joinPath(managed, other), []string{other}},
+		{"removes old php_home", joinPath(other, phpHomePath()), []string{other}},
+		{"drops empty entries", joinPath(other, "", managed, ""), []string{other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withoutManaged(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withoutManaged(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// 记录写入操作的 fakeEnv，用于检查没有变化时不会重写 PATH
+type recordingEnv struct {
+	*fakeEnv
+	writes []envScope
+}
+
+func (r *recordingEnv) Set(scope envScope, name, value string) error {
+	r.writes = append(r.writes, scope)
+	return r.fakeEnv.Set(scope, name, value)
+}
+
+func (r *recordingEnv) Delete(scope envScope, name string) error {
+	r.writes = append(r.writes, scope)
+	return r.fakeEnv.Delete(scope, name)
+}
+
+func TestDeactivate(t *testing.T) {
+	withTestRoot(t)
+	managed := managedPathDir()
+	other := filepath.Join(rootDir, "other")
+
+	tests := []struct {
+		name       string
+		user       string
+		system     string
+		wantUser   string
+		wantSystem string
+		wantWrites []envScope
+	}{
+		{"removes pvm from user", joinPath(managed, other), joinPath(other), other, other, []envScope{scopeUser}},
+		{"deletes emptied PATH", managed, "", "", "", []envScope{scopeUser}},
+		{"keeps trailing separator without pvm", joinPath(managed, other), joinPath(other, ""), other, joinPath(other, ""), []envScope{scopeUser}},
+		{"nothing to remove", joinPath(other, "", ""), joinPath(other, ""), joinPath(other, "", ""), joinPath(other, ""), nil},
+		{"both scopes", joinPath(managed, other), joinPath(other, managed), other, other, []envScope{scopeUser, scopeSystem}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &recordingEnv{fakeEnv: &fakeEnv{}}
+			env.fakeEnv.Set(scopeUser, "PATH", tt.user)
+			env.fakeEnv.Set(scopeSystem, "PATH", tt.system)
+			if err := deactivate(context.Background(), env); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := env.Get(scopeUser, "PATH"); got != tt.wantUser {
+				t.Errorf("user PATH = %q, want %q", got, tt.wantUser)
+			}
+			if got, _ := env.Get(scopeSystem, "PATH"); got != tt.wantSystem {
+				t.Errorf("system PATH = %q, want %q", got, tt.wantSystem)
+			}
+			if !reflect.DeepEqual(env.writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", env.writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestSetPathRecordsSnapshotOnce(t *testing.T) {
+	withTestRoot(t)
+	env := &fakeEnv{}
+	env.Set(scopeUser, "PATH", "original")
+	if err := setPath(env, scopeUser, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPath(env, scopeUser, "second"); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := loadSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshots[scopeUser].PATH; got != "original" {
+		t.Errorf("snapshot = %q, want %q", got, "original")
+	}
+	if _, ok := snapshots[scopeSystem]; ok {
+		t.Errorf("system scope should have no snapshot")
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	withTestRoot(t)
+	managed := managedPathDir()
+	a, b, c := filepath.Join(rootDir, "a"), filepath.Join(rootDir, "b"), filepath.Join(rootDir, "c")
+
+	tests := []struct {
+		name     string
+		snapshot string
+		current  string
+		want     string
+	}{
+		{"restores removed entries", joinPath(a, b), joinPath(managed, a), joinPath(a, b)},
+		{"keeps entries added later", joinPath(a, b), joinPath(managed, a, c), joinPath(a, b, c)},
+		{"drops pvm from snapshot", joinPath(managed, a), joinPath(managed, a), a},
+		{"deletes empty PATH", "", managed, ""},
+		{"unchanged", joinPath(a, b), joinPath(a, b), joinPath(a, b)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &fakeEnv{}
+			env.Set(scopeUser, "PATH", tt.current)
+			if err := restoreSnapshot(context.Background(), env, scopeUser, envSnapshot{PATH: tt.snapshot}, true); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := env.Get(scopeUser, "PATH"); got != tt.want {
+				t.Errorf("PATH = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
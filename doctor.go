@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"debug/pe"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 检查结果
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctor 的一项检查
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// 按顺序收集的检查结果
+type doctorReport struct {
+	checks []doctorCheck
+}
+
+func (r *doctorReport) add(status, name, detail, hint string) {
+	r.checks = append(r.checks, doctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+func (r *doctorReport) pass(name, detail string)       { r.add(doctorPass, name, detail, "") }
+func (r *doctorReport) warn(name, detail, hint string) { r.add(doctorWarn, name, detail, hint) }
+func (r *doctorReport) fail(name, detail, hint string) { r.add(doctorFail, name, detail, hint) }
+
+// 目录是否可以写入：创建并删除一个临时文件
+func dirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".pvm-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// 根目录、phps 和缓存目录存在并且可以写入
+func checkDirs(r *doctorReport) {
+	for _, dir := range []string{rootDir, phpsPath(), cachePath()} {
+		if !isDir(dir) {
+			if dir == rootDir {
+				r.warn("目录", dir+" 不存在", "运行 pvm install <版本> 会自动创建，或使用 --root / PVM_ROOT 指定其他目录")
+				return
+			}
+			r.warn("目录", dir+" 不存在", "安装或下载时会自动创建")
+			continue
+		}
+		if err := dirWritable(dir); err != nil {
+			r.fail("目录", fmt.Sprintf("%s 无法写入: %v", dir, err), "检查目录权限，或使用 --root / PVM_ROOT 指定其他目录")
+			continue
+		}
+		r.pass("目录", dir+" 可以写入")
+	}
+}
+
+// 清单可以解析，其中的目录都存在，phps 中没有未登记的目录
+func checkManifest(r *doctorReport) {
+	m, err := loadManifest()
+	if err != nil {
+		r.fail("版本清单", err.Error(), "修复或删除 "+manifestPath()+"，然后重新安装需要的版本")
+		return
+	}
+	problems := 0
+	for key, rec := range m {
+		if !isDir(filepath.Join(phpsPath(), rec.Dir)) {
+			r.fail("版本清单", fmt.Sprintf("%s 对应的目录 %s 不存在", key, rec.Dir), fmt.Sprintf("运行 pvm install %s 重新安装，或 pvm uninstall %s 删除这一项", key, key))
+			problems++
+		}
+	}
+	entries, _ := os.ReadDir(phpsPath())
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if _, found := m.findDir(e.Name()); !found {
+			r.warn("版本清单", e.Name()+" 没有登记在清单中", "运行 pvm install --from-dir "+filepath.Join(phpsPath(), e.Name())+" 登记，或手动删除该目录")
+			problems++
+		}
+	}
+	if problems == 0 {
+		r.pass("版本清单", fmt.Sprintf("%d 个版本，与 phps 中的目录一致", len(m)))
+	}
+}
+
+// 当前版本存在并且可以运行，返回是否可以继续检查其中的 php
+func checkCurrent(ctx context.Context, r *doctorReport) bool {
+	dir := currentDir()
+	if dir == "" {
+		r.warn("当前版本", "没有当前版本", "运行 pvm use <版本> 选择一个版本")
+		return false
+	}
+	if !isDir(dir) {
+		r.fail("当前版本", "php_home 指向的 "+dir+" 不存在", "运行 pvm use <版本> 重新选择版本")
+		return false
+	}
+	if !hasPHPBinary(dir) {
+		r.fail("当前版本", phpBinary+" 不存在于 "+dir, "运行 pvm install "+currentKey()+" 重新安装")
+		return false
+	}
+	_, want := currentSelection(dir)
+	if err := verifySwitch(ctx, want); err != nil {
+		r.fail("当前版本", err.Error(), "运行 pvm install "+currentKey()+" 重新安装，或 pvm use 切换到其他版本")
+		return false
+	}
+	r.pass("当前版本", fmt.Sprintf("%s（%s）可以正常运行", currentKey(), want))
+	return true
+}
+
+// pvm 的目录在持久化的 PATH 和当前终端的 PATH 中，并且排在其他 PHP 之前
+func checkPATH(r *doctorReport) {
+	env, scope := newEnvManager(), pathScope()
+	managed := managedPathDir()
+	value, err := env.Get(scope, "PATH")
+	switch {
+	case err != nil:
+		r.fail("PATH", fmt.Sprintf("读取 %s 中的 PATH 失败: %v", env.Location(scope), err), "")
+	case !pathContains(value, managed) && currentDir() == "":
+		r.warn("PATH", fmt.Sprintf("%s 不在 %s 的 PATH 中", managed, env.Location(scope)), "运行 pvm use <版本> 时会自动添加")
+		return
+	case !pathContains(value, managed):
+		r.fail("PATH", fmt.Sprintf("%s 不在 %s 的 PATH 中", managed, env.Location(scope)), "运行 pvm use <版本> 重新添加")
+	default:
+		if dirs := phpEntriesBefore(value, managed); len(dirs) > 0 {
+			r.warn("PATH", fmt.Sprintf("%s 中排在 pvm 之前的 %s 也包含 %s", env.Location(scope), strings.Join(dirs, "、"), phpBinary), "运行 pvm path clean 删除这些目录或把它们移到后面")
+		} else {
+			r.pass("PATH", fmt.Sprintf("%s 在 %s 的 PATH 中", managed, env.Location(scope)))
+		}
+	}
+
+	// Windows 上系统 PATH 排在用户 PATH 之前
+	if isWindows && scope == scopeUser {
+		if sys, err := env.Get(scopeSystem, "PATH"); err == nil {
+			for _, e := range analyzePath(sys, managed) {
+				if e.PHP && !e.Managed {
+					r.warn("PATH", fmt.Sprintf("系统 PATH 中的 %s 包含 %s，会优先于用户 PATH", e.Dir, phpBinary), "从系统 PATH 中删除该目录，或使用 pvm use --scope system")
+				}
+			}
+		}
+	}
+
+	if !pathContains(os.Getenv("PATH"), managed) {
+		hint := "新开一个终端"
+		if !isWindows {
+			hint += "，或运行 eval \"$(pvm env)\""
+		}
+		r.warn("当前终端", "当前终端的 PATH 中没有 "+managed, hint)
+		return
+	}
+	found, err := exec.LookPath(phpBinary)
+	if err != nil {
+		r.warn("当前终端", "当前终端中找不到 "+phpBinary, "")
+		return
+	}
+	if !samePath(filepath.Dir(found), managed) {
+		r.warn("当前终端", "当前终端中的 php 是 "+found+"，不是 pvm 管理的版本", "运行 pvm path 查看 PATH 中的其他 PHP 目录")
+		return
+	}
+	r.pass("当前终端", "php 指向 "+found)
+}
+
+// php.exe 依赖的 Visual C++ 运行库在 php.exe 旁边或系统目录中
+func checkVCRuntime(r *doctorReport) {
+	phpExe := filepath.Join(managedPathDir(), phpBinary)
+	f, err := pe.Open(phpExe)
+	if err != nil {
+		r.warn("VC++ 运行库", fmt.Sprintf("无法读取 %s: %v", phpExe, err), "")
+		return
+	}
+	libs, _ := f.ImportedLibraries()
+	machine := f.Machine
+	f.Close()
+
+	systemDirs := []string{filepath.Join(os.Getenv("SystemRoot"), "System32")}
+	if machine == pe.IMAGE_FILE_MACHINE_I386 && isDir(filepath.Join(os.Getenv("SystemRoot"), "SysWOW64")) {
+		systemDirs = []string{filepath.Join(os.Getenv("SystemRoot"), "SysWOW64")}
+	}
+	var missing []string
+	for _, lib := range libs {
+		name := strings.ToLower(lib)
+		if _, ok := runtimeToolchains[name]; !ok && !strings.HasPrefix(name, "vcruntime") && !strings.HasPrefix(name, "msvcp") {
+			continue
+		}
+		found := isFile(filepath.Join(managedPathDir(), lib))
+		for _, dir := range systemDirs {
+			found = found || isFile(filepath.Join(dir, lib))
+		}
+		if !found {
+			missing = append(missing, lib)
+		}
+	}
+	if len(missing) > 0 {
+		r.fail("VC++ 运行库", "缺少 "+strings.Join(missing, "、"), "安装对应版本的 Microsoft Visual C++ Redistributable（https://aka.ms/vs/17/release/vc_redist.x64.exe，32 位 PHP 使用 x86 版本）")
+		return
+	}
+	r.pass("VC++ 运行库", "php.exe 依赖的运行库都已安装")
+}
+
+// php.ini 已加载，extension_dir 指向存在的绝对路径
+func checkINI(ctx context.Context, r *doctorReport) {
+	stdout, _, err := runActivePHP(ctx, "--ini")
+	if err != nil {
+		r.warn("php.ini", fmt.Sprintf("运行 php --ini 失败: %v", err), "")
+		return
+	}
+	loaded := ""
+	for _, line := range strings.Split(stdout, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "Loaded Configuration File:"); ok {
+			loaded = strings.TrimSpace(v)
+		}
+	}
+	if loaded == "" || loaded == "(none)" {
+		r.warn("php.ini", "没有加载 php.ini", "把版本目录中的 php.ini-development 复制为 php.ini，或重新安装该版本")
+	} else {
+		r.pass("php.ini", "已加载 "+loaded)
+	}
+
+	stdout, _, err = runActivePHP(ctx, "-r", `echo ini_get("extension_dir");`)
+	if err != nil {
+		r.warn("extension_dir", fmt.Sprintf("读取 extension_dir 失败: %v", err), "")
+		return
+	}
+	extDir := strings.TrimSpace(stdout)
+	switch {
+	case extDir == "":
+		r.warn("extension_dir", "extension_dir 没有设置", "")
+	case !filepath.IsAbs(extDir):
+		r.warn("extension_dir", "extension_dir 是相对路径 "+extDir+"，只在当前目录为 PHP 目录时有效",
+			fmt.Sprintf("在 php.ini 中改为绝对路径，例如 extension_dir = \"%s\"", filepath.Join(phpHomePath(), "ext")))
+	case !isDir(extDir) && isWindows:
+		r.fail("extension_dir", extDir+" 不存在", "修改 php.ini 中的 extension_dir")
+	case !isDir(extDir):
+		// 静态构建的扩展编译在 php 中，默认的 extension_dir 通常不存在
+		r.warn("extension_dir", extDir+" 不存在", "使用共享扩展时修改 php.ini 中的 extension_dir")
+	default:
+		r.pass("extension_dir", extDir)
+	}
+}
+
+// 下载地址可以访问
+func checkNetwork(ctx context.Context, r *doctorReport) {
+	if offline {
+		r.warn("网络", "离线模式，跳过检查", "")
+		return
+	}
+	available := 0
+	for _, m := range downloadMirrors() {
+		res := testMirror(ctx, m)
+		if res.Available {
+			available++
+			r.pass("网络", fmt.Sprintf("%s 可以访问（%d ms）", m, res.LatencyMS))
+		} else {
+			r.warn("网络", fmt.Sprintf("%s 无法访问: %s", m, res.Error), "检查网络和代理设置，或使用 pvm mirror add 添加其他镜像")
+		}
+	}
+	if available == 0 {
+		last := &r.checks[len(r.checks)-1]
+		last.Status = doctorFail
+	}
+}
+
+// 检查 pvm 的运行环境，有失败的检查时以 exitCheck 退出
+func runDoctor(ctx context.Context, skipNetwork bool) error {
+	r := &doctorReport{}
+	checkDirs(r)
+	checkManifest(r)
+	if checkCurrent(ctx, r) {
+		if isWindows {
+			checkVCRuntime(r)
+		}
+		checkINI(ctx, r)
+	}
+	checkPATH(r)
+	if !skipNetwork {
+		checkNetwork(ctx, r)
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+
+	failed, warned := 0, 0
+	for _, c := range r.checks {
+		switch c.Status {
+		case doctorFail:
+			failed++
+		case doctorWarn:
+			warned++
+		}
+	}
+	if jsonOutput {
+		if err := printJSON(r.checks); err != nil {
+			return err
+		}
+	} else {
+		labels := map[string]string{doctorPass: "通过", doctorWarn: "警告", doctorFail: "失败"}
+		for _, c := range r.checks {
+			infof("[%s] %s: %s\n", labels[c.Status], c.Name, c.Detail)
+			if c.Hint != "" && c.Status != doctorPass {
+				infof("       %s\n", c.Hint)
+			}
+		}
+		infof("\n%d 项检查，%d 项警告，%d 项失败\n", len(r.checks), warned, failed)
+	}
+	if failed > 0 {
+		return withExitReported(exitCheck, fmt.Errorf("%d 项检查失败", failed))
+	}
+	return nil
+}
+
+func newDoctorCommand() *command {
+	var skipNetwork bool
+	return &command{
+		name:    "doctor",
+		summary: "检查 pvm 的运行环境",
+		description: `
+依次检查根目录是否可以写入、版本清单与 phps 中的目录是否一致、当前版本能否运行、
+PATH 中 pvm 的目录及其之前的其他 PHP、Windows 上 php.exe 依赖的 VC++ 运行库、
+php.ini 和 extension_dir，以及下载地址能否访问。每项结果为通过、警告或失败，并给出修复提示。
+有失败的检查时退出码为 6。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.BoolVar(&skipNetwork, "no-network", false, "不检查下载地址")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "doctor 命令不接受参数"); err != nil {
+				return err
+			}
+			return runDoctor(commandCtx, skipNetwork)
+		},
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	downloadAttempts     = 5                // 最多尝试次数
+	downloadBackoff      = 2 * time.Second  // 首次重试前的等待时间，之后每次翻倍
+	downloadMaxBackoff   = 30 * time.Second // 重试等待时间上限
+	downloadStallTimeout = 60 * time.Second // 超过该时长没有收到数据视为连接中断
+)
+
+// 未完成下载的元数据，用于判断服务器上的文件是否在两次下载之间发生了变化
+type partialMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Total        int64  `json:"total,omitempty"`
+}
+
+// 下载 url 到 dest，支持断点续传和失败重试。dest 已有的内容会通过 HTTP Range 继续下载，
+// 中断时保留已下载的部分，下次继续
+func downloadFile(ctx context.Context, url, dest string) (int64, error) {
+	if u, err := neturl.Parse(url); err == nil && u.Scheme == "file" {
+		return copyLocalFile(ctx, fileURLPath(u), dest)
+	}
+
+	backoff := downloadBackoff
+	var lastErr error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		n, err := downloadAttempt(ctx, url, dest)
+		if err == nil {
+			os.Remove(dest + ".json")
+			return n, nil
+		}
+		lastErr = err
+		if !isTransient(err) || attempt == downloadAttempts {
+			break
+		}
+		warnf("下载中断: %v，%s 后重试 (%d/%d)\n", err, backoff, attempt, downloadAttempts-1)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return 0, errInterrupted
+		}
+		backoff *= 2
+		if backoff > downloadMaxBackoff {
+			backoff = downloadMaxBackoff
+		}
+	}
+	return 0, lastErr
+}
+
+// 从本地镜像目录复制文件
+func copyLocalFile(ctx context.Context, src, dest string) (int64, error) {
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return 0, &httpStatusError{url: src, status: http.StatusNotFound}
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, fmt.Errorf("创建文件失败: %v", err)
+	}
+	defer out.Close()
+	n, err := io.Copy(out, &ctxReader{ctx: ctx, r: in})
+	if err != nil {
+		out.Close()
+		os.Remove(dest)
+		return 0, interrupted(ctx, fmt.Errorf("复制文件失败: %v", err))
+	}
+	return n, nil
+}
+
+// 单次下载尝试
+func downloadAttempt(parent context.Context, url, dest string) (int64, error) {
+	if err := checkOnline(url); err != nil {
+		return 0, err
+	}
+	var offset int64
+	meta := readPartialMeta(dest)
+	if info, err := os.Stat(dest); err == nil && meta.URL == url {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// 文件已变化时服务器会返回完整内容而不是剩余部分
+		if meta.ETag != "" {
+			req.Header.Set("If-Range", meta.ETag)
+		} else if meta.LastModified != "" {
+			req.Header.Set("If-Range", meta.LastModified)
+		}
+	}
+
+	client, err := downloadHTTPClient()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, interrupted(parent, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		infof("从 %s 处继续下载\n", formatSize(offset))
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 本地的部分文件无效，删除后重新下载
+		os.Remove(dest)
+		os.Remove(dest + ".json")
+		return 0, &httpStatusError{url: url, status: resp.StatusCode}
+	default:
+		return 0, &httpStatusError{url: url, status: resp.StatusCode}
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	writePartialMeta(dest, partialMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Total:        total,
+	})
+
+	out, err := os.OpenFile(dest, flags, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("创建文件失败: %v", err)
+	}
+	defer out.Close()
+
+	// 长时间收不到数据时取消请求
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+
+	p := newProgress(path.Base(url), offset, total)
+	buf := make([]byte, 64*1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			stall.Reset(downloadStallTimeout)
+			if _, err := out.Write(buf[:n]); err != nil {
+				p.finish()
+				return 0, fmt.Errorf("保存文件失败: %v", err)
+			}
+			p.add(int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			p.finish()
+			if parent.Err() != nil {
+				return 0, errInterrupted
+			}
+			if ctx.Err() != nil {
+				return 0, fmt.Errorf("超过 %s 没有收到数据", downloadStallTimeout)
+			}
+			return 0, rerr
+		}
+	}
+	p.finish()
+
+	if total >= 0 && p.done != total {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return p.done, nil
+}
+
+// 判断错误是否值得重试
+func isTransient(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		s := statusErr.status
+		return s >= 500 || s == http.StatusTooManyRequests || s == http.StatusRequestTimeout ||
+			s == http.StatusRequestedRangeNotSatisfiable
+	}
+	var codeErr *codedError
+	if errors.As(err, &codeErr) {
+		return false
+	}
+	// 其余的都是连接、超时或读取错误
+	return true
+}
+
+func readPartialMeta(dest string) partialMeta {
+	var meta partialMeta
+	data, err := os.ReadFile(dest + ".json")
+	if err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	return meta
+}
+
+func writePartialMeta(dest string, meta partialMeta) {
+	data, err := json.Marshal(meta)
+	if err == nil {
+		os.WriteFile(dest+".json", data, 0644)
+	}
+}
+
+// 下载进度显示。终端上显示进度条，否则定期输出一行进度
+type progress struct {
+	name     string
+	group    *progressGroup // 属于合并进度时由其负责显示
+	start    int64          // 本次下载开始时已有的字节数
+	done     int64
+	total    int64 // 未知时为 -1
+	begin    time.Time
+	last     time.Time
+	interval time.Duration
+	tty      bool
+	drawn    bool
+}
+
+func newProgress(name string, start, total int64) *progress {
+	p := &progress{
+		name:     name,
+		start:    start,
+		done:     start,
+		total:    total,
+		begin:    time.Now(),
+		interval: 10 * time.Second,
+		tty:      isTerminal(os.Stderr),
+	}
+	if p.tty {
+		p.interval = 200 * time.Millisecond
+	}
+	p.last = p.begin
+	if g := activeProgressGroup; g != nil {
+		g.join(p)
+	}
+	return p
+}
+
+func (p *progress) add(n int64) {
+	if p.group != nil {
+		p.group.add(p, n)
+		return
+	}
+	p.done += n
+	if time.Since(p.last) >= p.interval {
+		p.last = time.Now()
+		p.draw()
+	}
+}
+
+func (p *progress) finish() {
+	if p.group != nil {
+		p.group.leave(p)
+		return
+	}
+	if quiet {
+		return
+	}
+	if p.tty {
+		p.draw()
+		if p.drawn {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+func (p *progress) draw() {
+	if quiet {
+		return
+	}
+	p.drawn = true
+
+	elapsed := time.Since(p.begin).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.done-p.start) / elapsed
+	}
+	status := fmt.Sprintf("%s/s", formatSize(int64(rate)))
+
+	if p.total <= 0 {
+		line := fmt.Sprintf("已下载 %s  %s", formatSize(p.done), status)
+		if p.tty {
+			fmt.Fprintf(os.Stderr, "\r%-60s", line)
+		} else {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		return
+	}
+
+	percent := float64(p.done) / float64(p.total)
+	eta := "--"
+	if rate > 0 {
+		eta = (time.Duration(float64(p.total-p.done)/rate) * time.Second).Round(time.Second).String()
+	}
+	if !p.tty {
+		fmt.Fprintf(os.Stderr, "已下载 %s / %s (%.0f%%)  %s  剩余 %s\n",
+			formatSize(p.done), formatSize(p.total), percent*100, status, eta)
+		return
+	}
+
+	const width = 30
+	filled := int(percent * width)
+	if filled > width {
+		filled = width
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	if filled > 0 && filled < width {
+		bar = bar[:filled-1] + ">" + bar[filled:]
+	}
+	fmt.Fprintf(os.Stderr, "\r[%s] %3.0f%% %s/%s %s 剩余 %-8s",
+		bar, percent*100, formatSize(p.done), formatSize(p.total), status, eta)
+}
+
+// 同时下载多个文件时的合并进度，显示为一行
+type progressGroup struct {
+	mu       sync.Mutex
+	items    []*progress
+	bytes    int64 // 本次运行下载的总字节数
+	begin    time.Time
+	last     time.Time
+	interval time.Duration
+	tty      bool
+	drawn    bool
+}
+
+// 启用合并进度期间开始的下载都计入该进度，由 stop 结束
+var activeProgressGroup *progressGroup
+
+func startProgressGroup() *progressGroup {
+	g := &progressGroup{
+		begin:    time.Now(),
+		interval: 10 * time.Second,
+		tty:      isTerminal(os.Stderr),
+	}
+	if g.tty {
+		g.interval = 200 * time.Millisecond
+	}
+	g.last = g.begin
+	activeProgressGroup = g
+	return g
+}
+
+func (g *progressGroup) stop() {
+	activeProgressGroup = nil
+	if g.drawn && g.tty && !quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (g *progressGroup) join(p *progress) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p.group = g
+	g.items = append(g.items, p)
+}
+
+func (g *progressGroup) leave(p *progress) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, item := range g.items {
+		if item == p {
+			g.items = append(g.items[:i], g.items[i+1:]...)
+			break
+		}
+	}
+}
+
+func (g *progressGroup) add(p *progress, n int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p.done += n
+	g.bytes += n
+	if time.Since(g.last) >= g.interval {
+		g.last = time.Now()
+		g.draw()
+	}
+}
+
+// 输出每个文件的进度和合计速率，调用时需持有锁
+func (g *progressGroup) draw() {
+	if quiet {
+		return
+	}
+	g.drawn = true
+
+	parts := make([]string, 0, len(g.items)+1)
+	for _, p := range g.items {
+		name := p.name
+		if b, ok := parseBuildName(trimArchiveExt(name)); ok {
+			name = b.Version
+		}
+		if p.total > 0 {
+			parts = append(parts, fmt.Sprintf("%s %3.0f%%", name, float64(p.done)/float64(p.total)*100))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s", name, formatSize(p.done)))
+		}
+	}
+	rate := 0.0
+	if elapsed := time.Since(g.begin).Seconds(); elapsed > 0 {
+		rate = float64(g.bytes) / elapsed
+	}
+	parts = append(parts, fmt.Sprintf("合计 %s/s", formatSize(int64(rate))))
+	line := strings.Join(parts, " | ")
+	if g.tty {
+		fmt.Fprintf(os.Stderr, "\r%-78s", line)
+	} else {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadAttemptResume(t *testing.T) {
+	oldQuiet := quiet
+	quiet = true
+	t.Cleanup(func() { quiet = oldQuiet })
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var gotRange string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "php.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	url := srv.URL + "/php.zip"
+
+	tests := []struct {
+		name      string
+		partial   []byte // 已下载的部分，nil 表示没有
+		meta      partialMeta
+		wantRange string
+	}{
+		{"fresh download", nil, partialMeta{}, ""},
+		{"resumes partial file", content[:4000], partialMeta{URL: url, ETag: `"v2"`}, "bytes=4000-"},
+		{"file changed on server", []byte("stale data"), partialMeta{URL: url, ETag: `"v1"`}, "bytes=10-"},
+		{"partial from another url", []byte("other"), partialMeta{URL: srv.URL + "/other.zip"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "php.zip.part")
+			if tt.partial != nil {
+				if err := os.WriteFile(dest, tt.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+				writePartialMeta(dest, tt.meta)
+			}
+			n, err := downloadAttempt(context.Background(), url, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotRange != tt.wantRange {
+				t.Errorf("Range = %q, want %q", gotRange, tt.wantRange)
+			}
+			data, _ := os.ReadFile(dest)
+			if n != int64(len(content)) || !bytes.Equal(data, content) {
+				t.Errorf("downloaded %d bytes, file has %d bytes, want %d", n, len(data), len(content))
+			}
+		})
+	}
+}
+
+func TestDownloadAttemptRangeNotSatisfiable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "php.zip", time.Time{}, strings.NewReader("short"))
+	}))
+	defer srv.Close()
+	url := srv.URL + "/php.zip"
+
+	// 本地的部分文件比服务器上的文件还长，删除后由下一次尝试重新下载
+	dest := filepath.Join(t.TempDir(), "php.zip.part")
+	if err := os.WriteFile(dest, []byte("longer than the file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writePartialMeta(dest, partialMeta{URL: url})
+	_, err := downloadAttempt(context.Background(), url, dest)
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("err = %v, want 416", err)
+	}
+	if !isTransient(err) {
+		t.Errorf("416 should be retried")
+	}
+	if isFile(dest) || isFile(dest+".json") {
+		t.Errorf("partial file should be removed")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection error", io.ErrUnexpectedEOF, true},
+		{"server error", &httpStatusError{status: http.StatusBadGateway}, true},
+		{"rate limited", &httpStatusError{status: http.StatusTooManyRequests}, true},
+		{"not found", &httpStatusError{status: http.StatusNotFound}, false},
+		{"forbidden", &httpStatusError{status: http.StatusForbidden}, false},
+		{"interrupted", errInterrupted, false},
+		{"offline", withExit(exitNetwork, errors.New("offline")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
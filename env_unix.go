@@ -0,0 +1,254 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// shell 配置文件中由 pvm 维护的区块
+const (
+	rcBlockStart = "# >>> pvm >>>"
+	rcBlockEnd   = "# <<< pvm <<<"
+)
+
+// 把环境变量写入 shell 配置文件中由 pvm 维护的区块，其他内容保持不变。
+// 用户级写入 ~/.profile 以及已有的 ~/.bashrc、~/.zshrc，系统级写入 /etc/profile.d/pvm.sh；
+// 安装了 fish 时同时写入对应的 conf.d/pvm.fish
+type rcEnv struct {
+	home string
+}
+
+func platformEnvManager() EnvManager {
+	home, _ := os.UserHomeDir()
+	return rcEnv{home: home}
+}
+
+// 可以写入的 sh 配置文件，第一个总是会写入，其余的只在已存在时写入
+func (r rcEnv) shFiles(scope envScope) []string {
+	if scope == scopeSystem {
+		return []string{"/etc/profile.d/pvm.sh"}
+	}
+	return []string{
+		filepath.Join(r.home, ".profile"),
+		filepath.Join(r.home, ".bashrc"),
+		filepath.Join(r.home, ".zshrc"),
+	}
+}
+
+// fish 的配置文件，没有安装 fish 时返回空字符串
+func (r rcEnv) fishFile(scope envScope) string {
+	dir := filepath.Join(r.home, ".config", "fish")
+	if scope == scopeSystem {
+		dir = "/etc/fish"
+	}
+	if !isDir(dir) {
+		return ""
+	}
+	return filepath.Join(dir, "conf.d", "pvm.fish")
+}
+
+func (r rcEnv) Location(scope envScope) string {
+	if scope == scopeSystem {
+		return "/etc/profile.d/pvm.sh"
+	}
+	return "~/.profile 等 shell 配置文件"
+}
+
+// 区块中的一行，例如 export PATH="/home/me/.pvm/php_home/bin:$PATH"
+var rcExportPattern = regexp.MustCompile(`^export ([A-Za-z_][A-Za-z0-9_]*)="(.*)"$`)
+
+// 读取区块中的变量，按出现顺序返回
+func (r rcEnv) load(scope envScope) ([]string, map[string]string, error) {
+	for _, file := range r.shFiles(scope) {
+		lines, found, err := readRCBlock(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !found {
+			continue
+		}
+		var names []string
+		vars := make(map[string]string)
+		for _, line := range lines {
+			if m := rcExportPattern.FindStringSubmatch(line); m != nil {
+				names = append(names, m[1])
+				vars[m[1]] = unquoteRC(m[2])
+			}
+		}
+		return names, vars, nil
+	}
+	return nil, map[string]string{}, nil
+}
+
+// 读取 PATH 时，区块中没有设置的话返回 $PATH，表示沿用原来的 PATH
+func (r rcEnv) Get(scope envScope, name string) (string, error) {
+	_, vars, err := r.load(scope)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := vars[name]; ok {
+		return v, nil
+	}
+	if name == "PATH" {
+		return "$PATH", nil
+	}
+	return "", nil
+}
+
+func (r rcEnv) Set(scope envScope, name, value string) error {
+	// 只沿用原来的 PATH 时不需要设置
+	if name == "PATH" && value == "$PATH" {
+		return r.Delete(scope, name)
+	}
+	names, vars, err := r.load(scope)
+	if err != nil {
+		return err
+	}
+	if _, ok := vars[name]; !ok {
+		names = append(names, name)
+	}
+	vars[name] = value
+	return r.write(scope, names, vars)
+}
+
+func (r rcEnv) Delete(scope envScope, name string) error {
+	names, vars, err := r.load(scope)
+	if err != nil {
+		return err
+	}
+	if _, ok := vars[name]; !ok {
+		return nil
+	}
+	delete(vars, name)
+	var kept []string
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return r.write(scope, kept, vars)
+}
+
+// 把变量写入所有配置文件，没有变量时删除区块
+func (r rcEnv) write(scope envScope, names []string, vars map[string]string) error {
+	var sh, fish []string
+	for _, name := range names {
+		sh = append(sh, fmt.Sprintf(`export %s="%s"`, name, quoteRC(vars[name])))
+		fish = append(fish, fishSet(name, vars[name]))
+	}
+	for i, file := range r.shFiles(scope) {
+		if i > 0 && !isFile(file) {
+			continue
+		}
+		if err := writeRCBlock(file, sh); err != nil {
+			if os.IsPermission(err) && scope == scopeSystem {
+				return fmt.Errorf("%v\n修改系统配置需要 root 权限，请使用 sudo 运行，或使用 --scope user", err)
+			}
+			return err
+		}
+	}
+	if file := r.fishFile(scope); file != "" {
+		if err := writeRCBlock(file, fish); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 双引号中需要转义的字符，$ 不转义，以便引用 $PATH 等变量
+var rcQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+var rcUnquoter = strings.NewReplacer(`\\`, `\`, `\"`, `"`, "\\`", "`")
+
+func quoteRC(v string) string   { return rcQuoter.Replace(v) }
+func unquoteRC(v string) string { return rcUnquoter.Replace(v) }
+
+// fish 的 set 命令。PATH 按条目分开，$PATH 这样的引用不加引号
+func fishSet(name, value string) string {
+	parts := []string{value}
+	if name == "PATH" {
+		parts = filepath.SplitList(value)
+	}
+	var args []string
+	for _, p := range parts {
+		if strings.HasPrefix(p, "$") {
+			args = append(args, p)
+		} else {
+			args = append(args, "'"+strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(p)+"'")
+		}
+	}
+	return fmt.Sprintf("set -gx %s %s", name, strings.Join(args, " "))
+}
+
+// 读取配置文件中的 pvm 区块
+func readRCBlock(file string) ([]string, bool, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	var lines []string
+	inBlock, found := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == rcBlockStart:
+			inBlock, found = true, true
+		case line == rcBlockEnd:
+			inBlock = false
+		case inBlock:
+			lines = append(lines, line)
+		}
+	}
+	return lines, found, scanner.Err()
+}
+
+// 替换配置文件中的 pvm 区块，没有区块时追加到末尾；lines 为空时删除区块
+func writeRCBlock(file string, lines []string) error {
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var out []string
+	inBlock, replaced := false, false
+	block := append(append([]string{rcBlockStart}, lines...), rcBlockEnd)
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			switch {
+			case line == rcBlockStart:
+				inBlock = true
+				if len(lines) > 0 && !replaced {
+					out = append(out, block...)
+				}
+				replaced = true
+			case line == rcBlockEnd && inBlock:
+				inBlock = false
+			case !inBlock:
+				out = append(out, line)
+			}
+		}
+	}
+	if !replaced {
+		if len(lines) == 0 {
+			return nil
+		}
+		if len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
+		out = append(out, block...)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	debugf("更新 %s\n", file)
+	return os.WriteFile(file, []byte(strings.Join(out, "\n")+"\n"), 0644)
+}
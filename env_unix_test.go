@@ -0,0 +1,120 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRCBlockRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".profile")
+	original := "export EDITOR=vim\nalias ll='ls -l'\n"
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := [][]string{
+		{`export PATH="/opt/pvm/php_home/bin:$PATH"`},
+		{`export PATH="/opt/pvm/php_home/bin:$PATH"`, `export PHP_INI_SCAN_DIR="/opt/conf.d"`},
+		{`export PATH="/other:$PATH"`},
+	}
+	for i, lines := range steps {
+		if err := writeRCBlock(file, lines); err != nil {
+			t.Fatal(err)
+		}
+		got, found, err := readRCBlock(file)
+		if err != nil || !found || !reflect.DeepEqual(got, lines) {
+			t.Errorf("step %d: readRCBlock = %v, %v, %v; want %v", i, got, found, err, lines)
+		}
+		data, _ := os.ReadFile(file)
+		if !strings.HasPrefix(string(data), original) {
+			t.Errorf("step %d: content outside the block changed:\n%s", i, data)
+		}
+		if n := strings.Count(string(data), rcBlockStart); n != 1 {
+			t.Errorf("step %d: %d blocks, want 1", i, n)
+		}
+	}
+
+	// 没有变量时删除区块，只留下原来的内容和分隔的空行
+	if err := writeRCBlock(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := readRCBlock(file); found {
+		t.Errorf("block still present after removal")
+	}
+	if data, _ := os.ReadFile(file); strings.TrimRight(string(data), "\n") != strings.TrimRight(original, "\n") {
+		t.Errorf("content after removal = %q, want %q", data, original)
+	}
+}
+
+func TestRCBlockMissingFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "conf.d", "pvm.fish")
+	if lines, found, err := readRCBlock(file); err != nil || found || lines != nil {
+		t.Errorf("readRCBlock(missing) = %v, %v, %v", lines, found, err)
+	}
+	// 删除不存在的区块不创建文件
+	if err := writeRCBlock(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if isFile(file) {
+		t.Errorf("writeRCBlock(nil) created %s", file)
+	}
+	if err := writeRCBlock(file, []string{"set -gx PATH '/x' $PATH"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := readRCBlock(file); !found {
+		t.Errorf("block not written to new file")
+	}
+}
+
+func TestRCEnv(t *testing.T) {
+	home := t.TempDir()
+	env := rcEnv{home: home}
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("# bashrc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := env.Get(scopeUser, "PATH"); got != "$PATH" {
+		t.Errorf("Get(PATH) without block = %q, want $PATH", got)
+	}
+	values := map[string]string{
+		"PATH":  joinPath("/opt/pvm/php_home/bin", "$PATH"),
+		"QUOTE": `a "quoted" \ value`,
+	}
+	for name, value := range values {
+		if err := env.Set(scopeUser, name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range values {
+		if got, err := env.Get(scopeUser, name); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	// 已存在的 .bashrc 也写入区块，不存在的 .zshrc 不创建
+	if _, found, _ := readRCBlock(filepath.Join(home, ".bashrc")); !found {
+		t.Errorf(".bashrc has no block")
+	}
+	if isFile(filepath.Join(home, ".zshrc")) {
+		t.Errorf(".zshrc should not be created")
+	}
+
+	// PATH 设为 $PATH 等同于删除
+	if err := env.Set(scopeUser, "PATH", "$PATH"); err != nil {
+		t.Fatal(err)
+	}
+	lines, _, _ := readRCBlock(filepath.Join(home, ".profile"))
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "export QUOTE=") {
+		t.Errorf("block after deleting PATH = %v", lines)
+	}
+	if err := env.Delete(scopeUser, "QUOTE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := readRCBlock(filepath.Join(home, ".profile")); found {
+		t.Errorf("empty block should be removed")
+	}
+}
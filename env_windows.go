@@ -0,0 +1,207 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// 注册表中保存环境变量的位置
+const (
+	userEnvKey   = `Environment`
+	systemEnvKey = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procRegSetValueExW = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteValue = advapi32.NewProc("RegDeleteValueW")
+
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	procSendMessageTimeoutW = user32.NewProc("SendMessageTimeoutW")
+)
+
+const (
+	errorFileNotFound = syscall.Errno(2)
+	errorAccessDenied = syscall.Errno(5)
+	errorMoreData     = syscall.Errno(234)
+
+	hwndBroadcast   = 0xffff
+	wmSettingChange = 0x001a
+	smtoAbortIfHung = 0x0002
+)
+
+// 直接通过注册表 API 读写环境变量：保持 REG_EXPAND_SZ 类型，没有 setx 的 1024 字符限制。
+// 系统级的变量没有权限写入时，以管理员权限重新运行 pvm 写入
+type registryEnv struct{}
+
+func platformEnvManager() EnvManager {
+	return registryEnv{}
+}
+
+func (registryEnv) key(scope envScope) (syscall.Handle, string) {
+	if scope == scopeSystem {
+		return syscall.HKEY_LOCAL_MACHINE, systemEnvKey
+	}
+	return syscall.HKEY_CURRENT_USER, userEnvKey
+}
+
+func (r registryEnv) Location(scope envScope) string {
+	if scope == scopeSystem {
+		return `HKLM\` + systemEnvKey
+	}
+	return `HKCU\` + userEnvKey
+}
+
+func (r registryEnv) open(scope envScope, access uint32) (syscall.Handle, error) {
+	root, path := r.key(scope)
+	var h syscall.Handle
+	if err := syscall.RegOpenKeyEx(root, syscall.StringToUTF16Ptr(path), 0, access, &h); err != nil {
+		return 0, err
+	}
+	return h, nil
+}
+
+// 读取值和值类型，不存在时类型为 0
+func (r registryEnv) query(scope envScope, name string) (string, uint32, error) {
+	h, err := r.open(scope, syscall.KEY_QUERY_VALUE)
+	if err != nil {
+		return "", 0, err
+	}
+	defer syscall.RegCloseKey(h)
+
+	namePtr := syscall.StringToUTF16Ptr(name)
+	buf := make([]uint16, 1024)
+	for {
+		var typ uint32
+		size := uint32(len(buf) * 2)
+		err := syscall.RegQueryValueEx(h, namePtr, nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &size)
+		switch {
+		case err == errorFileNotFound:
+			return "", 0, nil
+		case err == errorMoreData:
+			buf = make([]uint16, size/2+1)
+			continue
+		case err != nil:
+			return "", 0, err
+		}
+		if typ != syscall.REG_SZ && typ != syscall.REG_EXPAND_SZ {
+			return "", typ, fmt.Errorf("%s 不是字符串类型的值", name)
+		}
+		return syscall.UTF16ToString(buf[:size/2]), typ, nil
+	}
+}
+
+func (r registryEnv) Get(scope envScope, name string) (string, error) {
+	v, _, err := r.query(scope, name)
+	return v, err
+}
+
+func (r registryEnv) Set(scope envScope, name, value string) error {
+	_, typ, err := r.query(scope, name)
+	if err != nil {
+		return err
+	}
+	// 新变量中引用了其他变量，或者是 PATH，使用 REG_EXPAND_SZ
+	if typ == 0 {
+		typ = syscall.REG_SZ
+		if strings.Contains(value, "%") || strings.EqualFold(name, "PATH") {
+			typ = syscall.REG_EXPAND_SZ
+		}
+	}
+
+	h, err := r.open(scope, syscall.KEY_SET_VALUE)
+	if err == errorAccessDenied && scope == scopeSystem {
+		return setElevated(name, value, false)
+	}
+	if err != nil {
+		return err
+	}
+	defer syscall.RegCloseKey(h)
+
+	data, err := syscall.UTF16FromString(value)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := procRegSetValueExW.Call(uintptr(h), uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(name))), 0,
+		uintptr(typ), uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2))
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	broadcastEnvChange()
+	return nil
+}
+
+func (r registryEnv) Delete(scope envScope, name string) error {
+	h, err := r.open(scope, syscall.KEY_SET_VALUE)
+	if err == errorAccessDenied && scope == scopeSystem {
+		return setElevated(name, "", true)
+	}
+	if err != nil {
+		return err
+	}
+	defer syscall.RegCloseKey(h)
+
+	ret, _, _ := procRegDeleteValue.Call(uintptr(h), uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(name))))
+	if ret != 0 && syscall.Errno(ret) != errorFileNotFound {
+		return syscall.Errno(ret)
+	}
+	broadcastEnvChange()
+	return nil
+}
+
+// 通知资源管理器等程序环境变量已更改，之后新开的终端会使用新的值
+func broadcastEnvChange() {
+	var result uintptr
+	procSendMessageTimeoutW.Call(hwndBroadcast, wmSettingChange, 0,
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("Environment"))), smtoAbortIfHung, 5000, uintptr(unsafe.Pointer(&result)))
+}
+
+// 以管理员权限运行 pvm _setenv 写入系统级的变量
+func setElevated(name, value string, remove bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"--root", rootDir, "_setenv", "--scope", string(scopeSystem)}
+	if remove {
+		args = append(args, "--delete", name)
+	} else {
+		valueFile, err := os.CreateTemp("", "pvm_env_*.txt")
+		if err != nil {
+			return fmt.Errorf("创建临时文件失败: %v", err)
+		}
+		defer os.Remove(valueFile.Name())
+		_, err = valueFile.WriteString(value)
+		valueFile.Close()
+		if err != nil {
+			return fmt.Errorf("写入临时文件失败: %v", err)
+		}
+		args = append(args, name, valueFile.Name())
+	}
+
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = `"` + strings.ReplaceAll(a, `"`, `\"`) + `"`
+	}
+	ps := fmt.Sprintf(`$p = Start-Process -FilePath '%s' -ArgumentList '%s' -Verb RunAs -Wait -PassThru -WindowStyle Hidden; exit $p.ExitCode`,
+		strings.ReplaceAll(exe, "'", "''"), strings.ReplaceAll(strings.Join(quoted, " "), "'", "''"))
+
+	infof("需要管理员权限修改系统环境变量，请在弹出的 UAC 提示中选择\"是\"\n")
+	output, err := exec.Command("powershell", "-NoProfile", "-Command", ps).CombinedOutput()
+	if err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("以管理员权限修改系统环境变量失败: %v, 输出: %s", err, strings.TrimSpace(string(output)))
+		}
+		return errors.New("以管理员权限修改系统环境变量失败，可能是取消了 UAC 提示")
+	}
+	debugf("已通过 %s 修改系统环境变量\n", filepath.Base(exe))
+	return nil
+}
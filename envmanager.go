@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 持久化环境变量的作用范围
+type envScope string
+
+const (
+	scopeUser   envScope = "user"   // 当前用户，不需要管理员权限
+	scopeSystem envScope = "system" // 所有用户，需要管理员权限
+)
+
+// --scope 参数，为空时使用 scope 设置
+var scopeOverride envScope
+
+// 解析作用范围
+func parseScope(v string) (envScope, error) {
+	switch s := envScope(v); s {
+	case scopeUser, scopeSystem:
+		return s, nil
+	}
+	return "", fmt.Errorf("无效的作用范围: %s，可选 user 或 system", v)
+}
+
+// 用于 --scope 参数，解析时检查取值
+type scopeFlag struct{ p *envScope }
+
+func (f scopeFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return string(*f.p)
+}
+
+func (f scopeFlag) Set(v string) error {
+	s, err := parseScope(v)
+	if err != nil {
+		return err
+	}
+	*f.p = s
+	return nil
+}
+
+// 修改 PATH 的作用范围：--scope 参数优先，其次是 scope 设置，默认为 user
+func pathScope() envScope {
+	if scopeOverride != "" {
+		return scopeOverride
+	}
+	if cfg.Scope != "" {
+		return envScope(cfg.Scope)
+	}
+	return scopeUser
+}
+
+// EnvManager 读写持久化的环境变量：Windows 上为注册表，其他平台为 shell 的配置文件。
+// 值按原样读写，可以引用其他变量（Windows 的 %VAR%、shell 的 $VAR），由后端保持原有的值类型
+type EnvManager interface {
+	// 读取变量，不存在时返回空字符串
+	Get(scope envScope, name string) (string, error)
+	// 写入变量，新的值立即对新开的终端生效
+	Set(scope envScope, name, value string) error
+	// 删除变量，不存在时不报错
+	Delete(scope envScope, name string) error
+	// 变量保存的位置，用于提示
+	Location(scope envScope) string
+}
+
+// 当前平台的环境变量后端。设置了 PVM_FAKE_ENV 时使用保存在该文件中的模拟后端，
+// 用于在不修改真实环境的情况下检查 PATH 的处理
+func newEnvManager() EnvManager {
+	if file := os.Getenv("PVM_FAKE_ENV"); file != "" {
+		return &fakeEnv{file: file}
+	}
+	return platformEnvManager()
+}
+
+// 模拟的环境变量后端，变量保存在 JSON 文件中（作用范围 => 变量名 => 值）。
+// file 为空时只保存在内存中
+type fakeEnv struct {
+	file string
+	vars map[envScope]map[string]string
+}
+
+func (f *fakeEnv) load() error {
+	if f.vars == nil {
+		f.vars = make(map[envScope]map[string]string)
+	}
+	if f.file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(f.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &f.vars)
+}
+
+func (f *fakeEnv) save() error {
+	if f.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.vars, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.file, data, 0644)
+}
+
+func (f *fakeEnv) Get(scope envScope, name string) (string, error) {
+	if err := f.load(); err != nil {
+		return "", err
+	}
+	return f.vars[scope][name], nil
+}
+
+func (f *fakeEnv) Set(scope envScope, name, value string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	if f.vars[scope] == nil {
+		f.vars[scope] = make(map[string]string)
+	}
+	f.vars[scope][name] = value
+	return f.save()
+}
+
+func (f *fakeEnv) Delete(scope envScope, name string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	delete(f.vars[scope], name)
+	return f.save()
+}
+
+func (f *fakeEnv) Location(scope envScope) string {
+	return fmt.Sprintf("%s (%s)", f.file, scope)
+}
+
+// 确保 dir 在持久化的 PATH 中，不在时添加到最前面
+func addToPath(ctx context.Context, env EnvManager, scope envScope, dir string) error {
+	value, err := env.Get(scope, "PATH")
+	if err != nil {
+		return interrupted(ctx, fmt.Errorf("读取 %s 中的 PATH 失败: %v", env.Location(scope), err))
+	}
+	if pathContains(value, dir) {
+		debugf("%s 已在 PATH 中（%s）\n", dir, env.Location(scope))
+		if dirs := phpEntriesBefore(value, dir); len(dirs) > 0 {
+			warnf("PATH 中排在 %s 之前的 %s 也包含 %s，会优先使用其中的 PHP\n", dir, strings.Join(dirs, "、"), phpBinary)
+			infof("运行 pvm path clean 可以删除这些目录或把它们移到后面\n")
+		}
+		return nil
+	}
+	infof("将 %s 添加到 PATH（%s）\n", dir, env.Location(scope))
+
+	// 修改 PATH 之前最后一次检查是否已被中断，之后的修改无法撤销
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if err := setPath(env, scope, prependPath(value, dir)); err != nil {
+		return interrupted(ctx, fmt.Errorf("更新 PATH 失败: %v", err))
+	}
+	infof("PATH 已更新\n")
+	return nil
+}
+
+// Windows 上用户 PATH 排在系统 PATH 之后，系统 PATH 中带有 php 的目录会覆盖用户 PATH 中的 dir。
+// 其他平台上用户的配置文件在系统配置之后执行，不会被覆盖
+func warnShadowed(env EnvManager, dir string) {
+	if !isWindows {
+		return
+	}
+	value, err := env.Get(scopeSystem, "PATH")
+	if err != nil {
+		debugf("读取系统 PATH 失败: %v\n", err)
+		return
+	}
+	found := false
+	for _, p := range filepath.SplitList(value) {
+		expanded := expandEnvRefs(p)
+		if p == "" || samePath(expanded, dir) {
+			continue
+		}
+		if isFile(filepath.Join(expanded, phpBinary)) {
+			warnf("系统 PATH 中的 %s 包含 %s，会优先于用户 PATH 中的 %s\n", p, phpBinary, dir)
+			found = true
+		}
+	}
+	if found {
+		infof("请从系统 PATH 中删除这些目录，或使用 pvm use --scope system 修改系统 PATH（需要管理员权限）\n")
+	}
+}
+
+// 内部命令：以管理员权限重新运行 pvm 时写入系统级的环境变量，值从文件读取以免被命令行转义
+func newSetenvCommand() *command {
+	var scope string
+	var remove bool
+	return &command{
+		name:   "_setenv",
+		args:   "<变量> <值文件>",
+		hidden: true,
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&scope, "scope", string(scopeSystem), "作用范围")
+			fs.BoolVar(&remove, "delete", false, "删除变量")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 1, 2, "用法: pvm _setenv [--delete] <变量> [<值文件>]"); err != nil {
+				return err
+			}
+			env := platformEnvManager()
+			if remove {
+				return env.Delete(envScope(scope), args[0])
+			}
+			if len(args) < 2 {
+				return usageErrorf("请指定值文件")
+			}
+			data, err := os.ReadFile(filepath.Clean(args[1]))
+			if err != nil {
+				return err
+			}
+			return env.Set(envScope(scope), args[0], string(data))
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 使用临时的根目录并关闭普通输出，测试结束后恢复
+func withTestRoot(t *testing.T) string {
+	t.Helper()
+	oldRoot, oldQuiet := rootDir, quiet
+	rootDir, quiet = t.TempDir(), true
+	t.Cleanup(func() { rootDir, quiet = oldRoot, oldQuiet })
+	return rootDir
+}
+
+// 用 PATH 分隔符连接目录
+func joinPath(dirs ...string) string {
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+func TestFakeEnvPersists(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "env.json")
+	env := &fakeEnv{file: file}
+	if err := env.Set(scopeUser, "PATH", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Set(scopeSystem, "PATH", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新的实例从文件读取
+	reopened := &fakeEnv{file: file}
+	for scope, want := range map[envScope]string{scopeUser: "a", scopeSystem: "b"} {
+		if got, err := reopened.Get(scope, "PATH"); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v; want %q", scope, got, err, want)
+		}
+	}
+	if err := reopened.Delete(scopeUser, "PATH"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := (&fakeEnv{file: file}).Get(scopeUser, "PATH"); got != "" {
+		t.Errorf("Get after Delete = %q, want empty", got)
+	}
+	// 删除不存在的变量不报错
+	if err := reopened.Delete(scopeUser, "MISSING"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestAddToPath(t *testing.T) {
+	withTestRoot(t)
+	other := filepath.Join(rootDir, "other")
+	managed := managedPathDir()
+
+	tests := []struct {
+		name, before, want string
+	}{
+		{"empty", "", managed},
+		{"prepends", other, joinPath(managed, other)},
+		{"already present", joinPath(other, managed), joinPath(other, managed)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &fakeEnv{}
+			env.Set(scopeUser, "PATH", tt.before)
+			if err := addToPath(context.Background(), env, scopeUser, managed); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := env.Get(scopeUser, "PATH"); got != tt.want {
+				t.Errorf("PATH = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
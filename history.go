@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 历史记录中的操作
+const (
+	actionUse       = "use"
+	actionInstall   = "install"
+	actionUninstall = "uninstall"
+)
+
+// 历史记录中的一项。切换版本时 From、To 为切换前后的版本名称，
+// 安装和卸载时 To 为版本名称；Source 为切换的来源（use、use -、install）或安装来源
+type historyEntry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to"`
+	Version string    `json:"version,omitempty"`
+	Source  string    `json:"source,omitempty"`
+}
+
+// 本次切换版本的来源，由 use - 和 install 设置
+var switchSource = "use"
+
+// 历史记录最多保留的条数
+const maxHistory = 1000
+
+func historyPath() string {
+	return filepath.Join(rootDir, "history.jsonl")
+}
+
+// 读取所有历史记录，按时间顺序排列。无法解析的行被跳过
+func loadHistory() ([]historyEntry, error) {
+	f, err := os.Open(historyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %v", err)
+	}
+	defer f.Close()
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			debugf("跳过无法解析的历史记录: %s\n", scanner.Text())
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// 追加一条历史记录，超过 maxHistory 条时去掉最早的记录。记录失败不影响命令本身
+func appendHistory(e historyEntry) {
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		debugf("创建根目录失败: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(historyPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		debugf("写入历史记录失败: %v\n", err)
+		return
+	}
+	_, err = f.Write(append(line, '\n'))
+	f.Close()
+	if err != nil {
+		debugf("写入历史记录失败: %v\n", err)
+		return
+	}
+
+	entries, err := loadHistory()
+	if err != nil || len(entries) <= maxHistory {
+		return
+	}
+	var data []byte
+	for _, e := range entries[len(entries)-maxHistory:] {
+		line, _ := json.Marshal(e)
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(historyPath(), data, 0644); err != nil {
+		debugf("整理历史记录失败: %v\n", err)
+	}
+}
+
+// 上一次切换前使用的版本，用于 pvm use -
+func previousVersion() (string, error) {
+	entries, err := loadHistory()
+	if err != nil {
+		return "", err
+	}
+	current := currentKey()
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Action != actionUse || e.From == "" || e.From == current {
+			continue
+		}
+		return e.From, nil
+	}
+	return "", withExit(exitNotFound, errors.New("没有可以返回的上一个版本"))
+}
+
+// 显示最近的安装、卸载和切换记录
+func showHistory(limit int) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	if jsonOutput {
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		return printJSON(entries)
+	}
+	if len(entries) == 0 {
+		infof("没有历史记录\n")
+		return nil
+	}
+	for _, e := range entries {
+		detail := e.To
+		switch e.Action {
+		case actionUse:
+			if e.From != "" {
+				detail = e.From + " -> " + e.To
+			}
+		case actionInstall, actionUninstall:
+			if e.Version != "" && e.Version != e.To {
+				detail += " (" + e.Version + ")"
+			}
+		}
+		if e.Source != "" {
+			detail += "  [" + e.Source + "]"
+		}
+		fmt.Printf("%s  %-9s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, detail)
+	}
+	return nil
+}
+
+func newHistoryCommand() *command {
+	var limit int
+	return &command{
+		name:    "history",
+		summary: "显示最近的安装、卸载和切换记录",
+		description: `
+历史记录保存在 <根目录>/history.jsonl 中，每行一条，最多保留 1000 条。
+切换记录中的来源为 use、use -（返回上一个版本）或 install（安装后自动切换）。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.IntVar(&limit, "limit", 20, "最多显示的条数，0 表示全部")
+			fs.IntVar(&limit, "n", 20, "--limit 的简写")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "history 命令不接受参数"); err != nil {
+				return err
+			}
+			return showHistory(limit)
+		},
+	}
+}
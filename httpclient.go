@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserAgent      = "pvm (PHP Version Manager)"
+	defaultRequestTimeout = 60 * time.Second // 目录页、校验和等小请求的总超时
+	defaultConnectTimeout = 15 * time.Second // 建立连接和 TLS 握手的超时
+)
+
+// 某个主机的认证信息。令牌和密码可以直接写在设置中，也可以从环境变量读取
+type hostAuth struct {
+	Type        string `json:"type"` // bearer 或 basic
+	Token       string `json:"token,omitempty"`
+	TokenEnv    string `json:"token_env,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+}
+
+// 离线模式，由 --offline 参数设置
+var offline bool
+
+// 离线模式下拒绝网络请求
+func checkOnline(rawURL string) error {
+	if offline {
+		return withExit(exitNetwork, fmt.Errorf("离线模式下禁止访问网络: %s", rawURL))
+	}
+	return nil
+}
+
+var (
+	clientOnce     sync.Once
+	requestClient  *http.Client // 带总超时，用于小请求
+	downloadClient *http.Client // 不设总超时，由下载的停滞检测负责超时
+	clientErr      error
+)
+
+// 用于目录页、校验和等小请求的客户端
+func httpClient() (*http.Client, error) {
+	clientOnce.Do(buildHTTPClients)
+	return requestClient, clientErr
+}
+
+// 用于下载大文件的客户端
+func downloadHTTPClient() (*http.Client, error) {
+	clientOnce.Do(buildHTTPClients)
+	return downloadClient, clientErr
+}
+
+// 根据设置构造共享的 HTTP 客户端
+func buildHTTPClients() {
+	transport, err := newTransport()
+	if err != nil {
+		clientErr = err
+		return
+	}
+	timeout := defaultRequestTimeout
+	if cfg.Timeout != "" {
+		if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			clientErr = fmt.Errorf("无效的 timeout 设置 %q: %v", cfg.Timeout, err)
+			return
+		}
+	}
+	rt := &authTransport{base: transport, netrc: loadNetrc()}
+	requestClient = &http.Client{Transport: rt, Timeout: timeout}
+	downloadClient = &http.Client{Transport: rt}
+}
+
+func newTransport() (*http.Transport, error) {
+	connectTimeout := defaultConnectTimeout
+	if cfg.ConnectTimeout != "" {
+		d, err := time.ParseDuration(cfg.ConnectTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 connect_timeout 设置 %q: %v", cfg.ConnectTimeout, err)
+		}
+		connectTimeout = d
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("无效的 proxy 设置 %q", cfg.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(cfg.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range cfg.CACerts {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("读取 CA 证书 %s 失败: %v", file, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA 证书 %s 中没有有效的 PEM 证书", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}, nil
+}
+
+// 为请求添加 User-Agent 和按主机配置的认证信息
+type authTransport struct {
+	base  http.RoundTripper
+	netrc map[string]netrcEntry
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	ua := cfg.UserAgent
+	if ua == "" {
+		ua = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+
+	// 认证信息只通过 https 发送，除非设置了 auth_over_http
+	if req.Header.Get("Authorization") == "" && (req.URL.Scheme == "https" || cfg.AuthOverHTTP) {
+		host := req.URL.Hostname()
+		if auth, ok := lookupAuth(host, req.URL.Host); ok {
+			switch strings.ToLower(auth.Type) {
+			case "bearer":
+				token := auth.Token
+				if auth.TokenEnv != "" {
+					token = os.Getenv(auth.TokenEnv)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			case "basic":
+				password := auth.Password
+				if auth.PasswordEnv != "" {
+					password = os.Getenv(auth.PasswordEnv)
+				}
+				req.SetBasicAuth(auth.Username, password)
+			}
+		} else if e, ok := t.netrc[host]; ok {
+			req.SetBasicAuth(e.login, e.password)
+		} else if e, ok := t.netrc[""]; ok && configuredHost(host) {
+			req.SetBasicAuth(e.login, e.password)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// 按 主机:端口 或 主机 查找认证设置
+func lookupAuth(host, hostPort string) (hostAuth, bool) {
+	if auth, ok := cfg.Auth[hostPort]; ok {
+		return auth, true
+	}
+	auth, ok := cfg.Auth[host]
+	return auth, ok
+}
+
+// 是否为设置中的镜像或下载目录所在的主机。.netrc 的 default 只用于这些主机，
+// 不会发送给跳转到的其他主机（例如 windows.php.net）
+func configuredHost(host string) bool {
+	urls := append([]string{cfg.QAURL, cfg.SnapshotURL, cfg.StaticURL, cfg.SourceURL}, cfg.Mirrors...)
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" && strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// .netrc 中的一项
+type netrcEntry struct {
+	login, password string
+}
+
+// 读取 .netrc，主机为空字符串的一项对应 default
+func loadNetrc() map[string]netrcEntry {
+	file := cfg.Netrc
+	if file == "" {
+		file = os.Getenv("NETRC")
+	}
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		file = filepath.Join(home, name)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	entries := make(map[string]netrcEntry)
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, strings.Fields(line)...)
+	}
+
+	machine, inEntry := "", false
+	var cur netrcEntry
+	flush := func() {
+		if inEntry {
+			entries[machine] = cur
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			flush()
+			if i+1 < len(tokens) {
+				i++
+				machine, cur, inEntry = tokens[i], netrcEntry{}, true
+			}
+		case "default":
+			flush()
+			machine, cur, inEntry = "", netrcEntry{}, true
+		case "login":
+			if i+1 < len(tokens) {
+				i++
+				cur.login = tokens[i]
+			}
+		case "password":
+			if i+1 < len(tokens) {
+				i++
+				cur.password = tokens[i]
+			}
+		case "account":
+			i++
+		case "macdef":
+			// 宏定义不参与认证，直接结束解析
+			flush()
+			return entries
+		}
+	}
+	flush()
+	debugf("已读取 %s 中的 %d 项认证信息\n", file, len(entries))
+	return entries
+}
+
+// 使用共享客户端发送 GET 请求
+func httpGet(ctx context.Context, rawURL string) (*http.Response, error) {
+	return httpRequest(ctx, rawURL, nil)
+}
+
+// 发送带有额外请求头的 GET 请求
+func httpRequest(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	if err := checkOnline(rawURL); err != nil {
+		return nil, err
+	}
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	return resp, nil
+}
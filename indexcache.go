@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 目录页缓存的默认有效期
+const defaultIndexTTL = time.Hour
+
+// 忽略有效期，重新验证缓存的目录页，由 ls-remote --refresh 设置
+var refreshIndex bool
+
+// 缓存的目录页的元数据
+type indexMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+func indexCachePath() string {
+	return filepath.Join(cachePath(), "index")
+}
+
+// 目录页缓存的有效期，可以通过 index_ttl 设置
+func indexTTL() time.Duration {
+	if cfg.IndexTTL != "" {
+		if d, err := time.ParseDuration(cfg.IndexTTL); err == nil {
+			return d
+		}
+		warnf("无效的 index_ttl 设置 %q，使用默认值 %s\n", cfg.IndexTTL, defaultIndexTTL)
+	}
+	return defaultIndexTTL
+}
+
+// 按地址生成缓存文件名
+func indexCacheFiles(rawURL string) (string, string) {
+	sum := sha256.Sum256([]byte(rawURL))
+	name := hex.EncodeToString(sum[:8])
+	return filepath.Join(indexCachePath(), name+".html"), filepath.Join(indexCachePath(), name+".json")
+}
+
+// 读取 http(s) 目录页。有效期内直接使用缓存；过期后带上 ETag 和
+// Last-Modified 重新验证，服务器返回 304 时继续使用缓存。
+// 离线或网络出错时使用过期的缓存
+func fetchIndexURL(ctx context.Context, rawURL string) ([]byte, error) {
+	dataFile, metaFile := indexCacheFiles(rawURL)
+	var meta indexMeta
+	cached, err := os.ReadFile(dataFile)
+	if err == nil {
+		if metaData, err := os.ReadFile(metaFile); err != nil || json.Unmarshal(metaData, &meta) != nil || meta.URL != rawURL {
+			cached = nil
+		}
+	}
+
+	if cached != nil {
+		age := time.Since(meta.Fetched)
+		if offline || (!refreshIndex && age < indexTTL()) {
+			debugf("使用缓存的目录页 %s（%s 前获取）\n", rawURL, age.Round(time.Second))
+			return cached, nil
+		}
+	}
+
+	header := make(http.Header)
+	if cached != nil {
+		if meta.ETag != "" {
+			header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := httpRequest(ctx, rawURL, header)
+	if err != nil {
+		if cached != nil && ctx.Err() == nil {
+			warnf("获取 %s 失败: %v，使用 %s 前缓存的目录页\n", rawURL, err, time.Since(meta.Fetched).Round(time.Minute))
+			return cached, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, &httpStatusError{url: rawURL, status: resp.StatusCode}
+		}
+		debugf("目录页 %s 未变化\n", rawURL)
+		meta.Fetched = time.Now()
+		saveIndexCache(rawURL, nil, meta)
+		return cached, nil
+	case http.StatusOK:
+	default:
+		return nil, &httpStatusError{url: rawURL, status: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	saveIndexCache(rawURL, data, indexMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	})
+	return data, nil
+}
+
+// 保存目录页缓存，data 为 nil 时只更新元数据
+func saveIndexCache(rawURL string, data []byte, meta indexMeta) {
+	dataFile, metaFile := indexCacheFiles(rawURL)
+	if err := os.MkdirAll(indexCachePath(), 0755); err != nil {
+		debugf("创建目录页缓存目录失败: %v\n", err)
+		return
+	}
+	if data != nil {
+		if err := os.WriteFile(dataFile, data, 0644); err != nil {
+			debugf("保存目录页缓存失败: %v\n", err)
+			return
+		}
+	}
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(metaFile, metaData, 0644); err != nil {
+		debugf("保存目录页缓存失败: %v\n", err)
+	}
+}
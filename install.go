@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 默认同时下载的版本数
+const defaultInstallJobs = 3
+
+// 同时安装多个版本时每个版本的结果
+type installResult struct {
+	Version string `json:"version"`
+	Dir     string `json:"dir,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+
+	archive string
+	record  installRecord
+	err     error
+}
+
+// 同时安装多个版本：并发下载，再依次解压和登记。
+// 一个版本失败不影响其他版本，最后输出每个版本的结果，安装后不切换版本
+func installVersions(ctx context.Context, versions []string, jobs int) error {
+	if jobs < 1 {
+		return usageErrorf("--jobs 必须大于 0")
+	}
+
+	// 清理以前运行残留的临时文件
+	cleanTempArtifacts(staleTempAge)
+
+	cache, err := openDownloadCache()
+	if err != nil {
+		return err
+	}
+
+	// 去掉重复的版本，保持输入顺序
+	seen := make(map[string]bool)
+	results := make([]*installResult, 0, len(versions))
+	for _, v := range versions {
+		v = normalizeVersion(v)
+		if !seen[v] {
+			seen[v] = true
+			// eol_policy 拒绝的版本直接记为失败，不下载
+			results = append(results, &installResult{Version: v, err: checkLifecycle(versionSeries(v))})
+		}
+	}
+
+	// 有限数量的下载任务并发执行，进度合并显示为一行
+	infof("正在下载 %d 个版本（同时下载 %d 个）...\n", len(results), jobs)
+	queue := make(chan *installResult)
+	var wg sync.WaitGroup
+	group := startProgressGroup()
+	for i := 0; i < jobs && i < len(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				if ctx.Err() != nil {
+					r.err = errInterrupted
+					continue
+				}
+				r.archive, r.record, r.err = fetchRelease(ctx, cache, r.Version)
+			}
+		}()
+	}
+	for _, r := range results {
+		if r.err == nil {
+			queue <- r
+		}
+	}
+	close(queue)
+	wg.Wait()
+	group.stop()
+
+	// 依次解压和登记，避免同时修改版本清单
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			r.err = errInterrupted
+			continue
+		}
+		infof("正在安装 PHP %s...\n", r.Version)
+		if _, r.err = installArchive(ctx, r.Version, r.archive, r.record); r.err == nil {
+			r.Dir = r.record.Dir
+		}
+	}
+
+	// 汇总结果
+	var failed []*installResult
+	for _, r := range results {
+		r.OK = r.err == nil
+		if r.err != nil {
+			r.Error = r.err.Error()
+			failed = append(failed, r)
+		}
+	}
+	if jsonOutput {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		infof("\n安装结果:\n")
+		for _, r := range results {
+			if r.OK {
+				infof("  [成功] %s => %s\n", r.Version, r.Dir)
+			} else {
+				infof("  [失败] %s: %v\n", r.Version, r.err)
+			}
+		}
+		if len(failed) < len(results) {
+			infof("\n使用 pvm use <版本> 切换到已安装的版本\n")
+		}
+	}
+
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if len(failed) > 0 {
+		return withExitReported(exitCodeOf(failed[0].err), fmt.Errorf("%d 个版本安装失败", len(failed)))
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PHP 各主次版本的支持周期，日期格式为 2006-01-02
+type lifecycle struct {
+	Series        string `json:"series"`
+	ActiveUntil   string `json:"active_until"`   // 活跃支持截止日期
+	SecurityUntil string `json:"security_until"` // 安全更新截止日期，之后停止维护
+}
+
+// 支持状态
+const (
+	supportActive   = "active"   // 活跃支持
+	supportSecurity = "security" // 仅安全更新
+	supportEOL      = "eol"      // 已停止维护
+	supportUnknown  = "unknown"  // 没有该版本的数据
+)
+
+var supportNames = map[string]string{
+	supportActive:   "活跃支持",
+	supportSecurity: "仅安全更新",
+	supportEOL:      "已停止维护",
+	supportUnknown:  "未知",
+}
+
+// 内置的支持周期数据，来自 https://www.php.net/supported-versions.php
+// 和 https://www.php.net/eol.php。可以通过 pvm eol update 更新
+var bundledLifecycles = []lifecycle{
+	{"5.3", "2014-08-14", "2014-08-14"},
+	{"5.4", "2015-09-03", "2015-09-03"},
+	{"5.5", "2016-07-21", "2016-07-21"},
+	{"5.6", "2017-01-19", "2018-12-31"},
+	{"7.0", "2018-01-04", "2019-01-10"},
+	{"7.1", "2018-12-01", "2019-12-01"},
+	{"7.2", "2019-11-30", "2020-11-30"},
+	{"7.3", "2020-12-06", "2021-12-06"},
+	{"7.4", "2021-11-28", "2022-11-28"},
+	{"8.0", "2022-11-26", "2023-11-26"},
+	{"8.1", "2023-11-25", "2025-12-31"},
+	{"8.2", "2024-12-31", "2026-12-31"},
+	{"8.3", "2025-12-31", "2027-12-31"},
+	{"8.4", "2026-12-31", "2028-12-31"},
+	{"8.5", "2027-12-31", "2029-12-31"},
+}
+
+// 默认的更新地址，格式与 endoflife.date 的 API 相同
+const defaultEOLURL = "https://endoflife.date/api/php.json"
+
+// 停止维护版本的处理方式，可以通过 eol_policy 设置
+const (
+	eolPolicyWarn   = "warn"   // 安装或切换时警告（默认）
+	eolPolicyRefuse = "refuse" // 拒绝安装或切换
+	eolPolicyIgnore = "ignore" // 不提示
+)
+
+// 忽略 eol_policy，由 install 和 use 的 --allow-eol 设置
+var allowEOL bool
+
+func lifecyclePath() string {
+	return filepath.Join(cachePath(), "eol.json")
+}
+
+// 已读取的支持周期数据，pvm eol update 后清空
+var loadedLifecycles map[string]lifecycle
+
+// 当前使用的支持周期数据：更新下载的数据覆盖内置数据
+func lifecycles() map[string]lifecycle {
+	if loadedLifecycles != nil {
+		return loadedLifecycles
+	}
+	list := make(map[string]lifecycle)
+	loadedLifecycles = list
+	for _, l := range bundledLifecycles {
+		list[l.Series] = l
+	}
+	data, err := os.ReadFile(lifecyclePath())
+	if err != nil {
+		return list
+	}
+	var updated []lifecycle
+	if err := json.Unmarshal(data, &updated); err != nil {
+		warnf("支持周期数据 %s 已损坏，使用内置数据: %v\n", lifecyclePath(), err)
+		return list
+	}
+	for _, l := range updated {
+		list[l.Series] = l
+	}
+	return list
+}
+
+// 某个主次版本在 now 时的支持状态
+func supportStatus(series string, now time.Time) (string, lifecycle) {
+	l, ok := lifecycles()[series]
+	if !ok {
+		return supportUnknown, lifecycle{Series: series}
+	}
+	today := now.Format("2006-01-02")
+	switch {
+	case l.ActiveUntil != "" && today <= l.ActiveUntil:
+		return supportActive, l
+	case l.SecurityUntil != "" && today <= l.SecurityUntil:
+		return supportSecurity, l
+	default:
+		return supportEOL, l
+	}
+}
+
+// 每个主次版本只提示一次，install 之后自动 use 时不重复警告
+var eolWarned = make(map[string]bool)
+
+// 按 eol_policy 检查是否可以安装或切换到某个主次版本
+func checkLifecycle(series string) error {
+	policy := cfg.EOLPolicy
+	if policy == "" {
+		policy = eolPolicyWarn
+	}
+	if policy == eolPolicyIgnore || eolWarned[series] {
+		return nil
+	}
+	status, l := supportStatus(series, time.Now())
+	if status != supportEOL {
+		return nil
+	}
+	eolWarned[series] = true
+	msg := fmt.Sprintf("PHP %s %s，不再提供安全更新", series, formatSupport(status, l))
+	if policy == eolPolicyRefuse && !allowEOL {
+		return withExit(exitCheck, errors.New(msg+"\n当前设置禁止使用已停止维护的版本，可以使用 --allow-eol 忽略，或运行 pvm config set eol_policy warn"))
+	}
+	warnf("%s\n", msg)
+	return nil
+}
+
+// 解析 endoflife.date 格式的数据：support 和 eol 为日期或布尔值
+func parseEOLFeed(data []byte) ([]lifecycle, error) {
+	var feed []struct {
+		Cycle   string          `json:"cycle"`
+		Support json.RawMessage `json:"support"`
+		EOL     json.RawMessage `json:"eol"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("解析支持周期数据失败: %v", err)
+	}
+	var list []lifecycle
+	for _, f := range feed {
+		if f.Cycle == "" {
+			continue
+		}
+		l := lifecycle{Series: f.Cycle, ActiveUntil: feedDate(f.Support, false), SecurityUntil: feedDate(f.EOL, true)}
+		if l.SecurityUntil == "" {
+			continue
+		}
+		if l.ActiveUntil == "" {
+			l.ActiveUntil = l.SecurityUntil
+		}
+		list = append(list, l)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("支持周期数据中没有可用的版本")
+	}
+	return list, nil
+}
+
+// 日期字段：字符串为截止日期；布尔值只说明是否已经结束，
+// support 为 true 表示仍在支持，eol 为 true 表示已经停止维护
+func feedDate(raw json.RawMessage, trueMeansEnded bool) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if _, err := time.Parse("2006-01-02", s); err == nil {
+			return s
+		}
+		return ""
+	}
+	var b bool
+	if json.Unmarshal(raw, &b) != nil {
+		return ""
+	}
+	if b == trueMeansEnded {
+		return "0001-01-01"
+	}
+	return "9999-12-31"
+}
+
+// 从地址或本地文件更新支持周期数据
+func updateLifecycles(ctx context.Context, source string) error {
+	if source == "" {
+		source = cfg.EOLURL
+	}
+	if source == "" {
+		source = defaultEOLURL
+	}
+	data, err := readSource(ctx, source)
+	if err != nil {
+		return withExit(exitNetwork, fmt.Errorf("读取支持周期数据失败: %v", err))
+	}
+	list, err := parseEOLFeed(data)
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool { return compareVersions(list[i].Series, list[j].Series) < 0 })
+	out, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cachePath(), 0755); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	if err := os.WriteFile(lifecyclePath(), out, 0644); err != nil {
+		return fmt.Errorf("保存支持周期数据失败: %v", err)
+	}
+	loadedLifecycles = nil
+	infof("已从 %s 更新 %d 个版本的支持周期\n", source, len(list))
+	return nil
+}
+
+// 读取 http(s)、file:// 地址或本地文件的内容
+func readSource(ctx context.Context, source string) ([]byte, error) {
+	if !strings.Contains(source, "://") {
+		return os.ReadFile(source)
+	}
+	body, err := openURL(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// 显示支持状态，例如 "仅安全更新，至 2026-12-31"
+func formatSupport(status string, l lifecycle) string {
+	var prefix, date string
+	switch status {
+	case supportActive:
+		prefix, date = "至", l.ActiveUntil
+	case supportSecurity:
+		prefix, date = "至", l.SecurityUntil
+	case supportEOL:
+		prefix, date = "自", l.SecurityUntil
+	}
+	// 更新的数据中只有布尔值时没有具体日期
+	if date == "" || date == "0001-01-01" || date == "9999-12-31" {
+		return supportNames[status]
+	}
+	return fmt.Sprintf("%s，%s %s", supportNames[status], prefix, date)
+}
+
+func newEOLCommand() *command {
+	var from string
+	return &command{
+		name:    "eol",
+		summary: "查看和更新 PHP 各版本的支持周期",
+		description: `
+内置 PHP 各主次版本的活跃支持和安全更新截止日期，list 和 ls-remote 会显示支持状态，
+安装或切换到已停止维护的版本时会发出警告。设置 eol_policy 为 refuse 可以拒绝这些版本，
+为 ignore 则不再提示。`,
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "列出各主次版本的支持状态",
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "eol list 命令不接受参数"); err != nil {
+						return err
+					}
+					all := lifecycles()
+					series := make([]string, 0, len(all))
+					for s := range all {
+						series = append(series, s)
+					}
+					sort.Slice(series, func(i, j int) bool { return compareVersions(series[i], series[j]) < 0 })
+
+					type row struct {
+						lifecycle
+						Status string `json:"status"`
+					}
+					rows := make([]row, 0, len(series))
+					for _, s := range series {
+						status, l := supportStatus(s, time.Now())
+						rows = append(rows, row{l, status})
+					}
+					if jsonOutput {
+						return printJSON(rows)
+					}
+					for _, r := range rows {
+						infof("  %-6s %s\n", r.Series, formatSupport(r.Status, r.lifecycle))
+					}
+					return nil
+				},
+			},
+			{
+				name:    "update",
+				summary: "更新支持周期数据",
+				setup: func(fs *flag.FlagSet) {
+					fs.StringVar(&from, "from", "", "数据的地址或本地文件，格式与 "+defaultEOLURL+" 相同，默认使用 eol_url 设置")
+				},
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "eol update 命令不接受参数，请使用 --from 指定数据来源"); err != nil {
+						return err
+					}
+					return updateLifecycles(commandCtx, from)
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 安装来源
+const (
+	sourceDownload = "download" // 从镜像下载
+	sourceFile     = "file"     // 本地压缩包（--from-file）
+	sourceDir      = "dir"      // 本地目录（--from-dir）
+	sourceBuild    = "source"   // 从源码编译（--source）
+)
+
+// versions.json 中的一项，键为安装时使用的短版本号
+type installRecord struct {
+	Dir       string    `json:"dir"`
+	Version   string    `json:"version,omitempty"`
+	Flavour   string    `json:"flavour,omitempty"`
+	Arch      string    `json:"arch,omitempty"`
+	Toolchain string    `json:"toolchain,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Variants  []string  `json:"variants,omitempty"` // 从源码编译时使用的变体
+	SHA256    string    `json:"sha256,omitempty"`
+	Installed time.Time `json:"installed,omitempty"`
+}
+
+// 兼容旧格式：旧版本的 versions.json 只保存目录名
+func (r *installRecord) UnmarshalJSON(data []byte) error {
+	var dir string
+	if err := json.Unmarshal(data, &dir); err == nil {
+		*r = installRecord{Dir: dir}
+		if b, ok := parseBuildName(dir); ok {
+			r.Version, r.Flavour, r.Arch, r.Toolchain = b.Version, b.Flavour, b.Arch, b.Toolchain
+		}
+		return nil
+	}
+	type plain installRecord
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// 已安装版本的清单（短版本号 => 安装信息）
+type manifest map[string]installRecord
+
+func manifestPath() string {
+	return filepath.Join(phpsPath(), "versions.json")
+}
+
+// 读取清单，文件不存在时返回空清单
+func loadManifest() (manifest, error) {
+	m := make(manifest)
+	data, err := os.ReadFile(manifestPath())
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取版本映射失败: %v", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("解析版本映射失败: %v", err)
+	}
+	return m, nil
+}
+
+// 保存清单
+func (m manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("保存版本信息失败: %v", err)
+	}
+	if err := os.MkdirAll(phpsPath(), 0755); err != nil {
+		return fmt.Errorf("创建 phps 目录失败: %v", err)
+	}
+	if err := os.WriteFile(manifestPath(), data, 0644); err != nil {
+		return fmt.Errorf("写入版本文件失败: %v", err)
+	}
+	return nil
+}
+
+// 查找使用某个目录的清单项
+func (m manifest) findDir(dirName string) (string, bool) {
+	for key, r := range m {
+		if r.Dir == dirName {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 官方镜像，存放当前版本，历史版本位于其下的 archives/ 目录
+const defaultMirror = "https://windows.php.net/downloads/releases/"
+
+// 历史版本所在的子目录
+const archivesDir = "archives/"
+
+// 按优先级排列的镜像列表
+func mirrors() []string {
+	if len(cfg.Mirrors) == 0 {
+		return []string{defaultMirror}
+	}
+	return cfg.Mirrors
+}
+
+// 规范化镜像地址：本地目录转换为 file:// 地址，并确保以 / 结尾
+func normalizeMirror(m string) (string, error) {
+	m = strings.TrimSpace(m)
+	if m == "" {
+		return "", errors.New("镜像地址不能为空")
+	}
+	if !strings.Contains(m, "://") {
+		abs, err := filepath.Abs(m)
+		if err != nil {
+			return "", fmt.Errorf("无效的目录 %s: %v", m, err)
+		}
+		m = (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+		if !strings.HasPrefix(m, "file:///") {
+			// Windows 盘符路径需要三个斜杠
+			m = strings.Replace(m, "file://", "file:///", 1)
+		}
+	}
+	u, err := url.Parse(m)
+	if err != nil {
+		return "", fmt.Errorf("无效的镜像地址 %s: %v", m, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+	default:
+		return "", fmt.Errorf("不支持的镜像协议: %s", u.Scheme)
+	}
+	if !strings.HasSuffix(m, "/") {
+		m += "/"
+	}
+	return m, nil
+}
+
+// 将 file:// 地址转换为本地路径
+func fileURLPath(u *url.URL) string {
+	p := u.Path
+	// file:///D:/mirror/ 的路径为 /D:/mirror/
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+// 打开一个 http(s) 或 file 地址，用于读取目录页、校验和等小文件
+func openURL(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "file" {
+		p := fileURLPath(u)
+		if strings.HasSuffix(rawURL, "/") {
+			return listLocalDir(p)
+		}
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			return nil, &httpStatusError{url: rawURL, status: http.StatusNotFound}
+		}
+		return f, err
+	}
+
+	resp, err := httpGet(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &httpStatusError{url: rawURL, status: resp.StatusCode}
+	}
+	return resp.Body, nil
+}
+
+// 把本地目录的文件列表转换为类似目录页的文本，每行一个文件名
+func listLocalDir(dir string) (io.ReadCloser, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.Name())
+		b.WriteString("\n")
+	}
+	return io.NopCloser(strings.NewReader(b.String())), nil
+}
+
+// 本次运行中已读取的目录页，同时安装多个版本时只读取一次
+var (
+	indexMu    sync.Mutex
+	indexPages = make(map[string]indexPage)
+)
+
+type indexPage struct {
+	data   []byte
+	mirror string
+}
+
+// 依次尝试各个镜像，读取 sub 目录的目录页，返回内容和使用的镜像
+func fetchIndexPage(ctx context.Context, sub string) ([]byte, string, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if page, ok := indexPages[sub]; ok {
+		return page.data, page.mirror, nil
+	}
+
+	var lastErr error
+	for _, m := range mirrors() {
+		// 离线模式下只使用本地镜像和缓存的目录页
+		data, err := readIndexPage(ctx, m+sub)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", errInterrupted
+			}
+			if !offline {
+				warnf("镜像 %s 不可用: %v\n", m, err)
+			}
+			lastErr = err
+			continue
+		}
+		debugf("使用镜像 %s 获取 %s\n", m, sub)
+		indexPages[sub] = indexPage{data: data, mirror: m}
+		return data, m, nil
+	}
+	return nil, "", withExit(exitNetwork, fmt.Errorf("所有镜像都不可用: %v", lastErr))
+}
+
+// 读取一个目录页，http(s) 地址经过目录页缓存
+func readIndexPage(ctx context.Context, rawURL string) ([]byte, error) {
+	if !strings.HasPrefix(rawURL, "file://") {
+		return fetchIndexURL(ctx, rawURL)
+	}
+	body, err := openURL(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// 镜像测试结果
+type mirrorResult struct {
+	Mirror    string `json:"mirror"`
+	Available bool   `json:"available"`
+	LatencyMS int64  `json:"latency_ms"`
+	Versions  int    `json:"versions"`
+	Error     string `json:"error,omitempty"`
+}
+
+// 测试镜像的可用性与延迟：读取目录页并统计其中的版本数
+func testMirror(ctx context.Context, m string) mirrorResult {
+	r := mirrorResult{Mirror: m}
+	start := time.Now()
+	body, err := openURL(ctx, m)
+	if err == nil {
+		var data []byte
+		data, err = io.ReadAll(body)
+		body.Close()
+		r.Versions = len(regexp.MustCompile(`php-\d+\.\d+\.\d+-[^"<>\s]*\.zip`).FindAll(data, -1))
+	}
+	r.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Available = true
+	return r
+}
+
+func newMirrorCommand() *command {
+	var first bool
+	return &command{
+		name:    "mirror",
+		summary: "管理下载镜像",
+		description: `
+镜像按顺序使用，前一个不可用时自动切换到下一个。镜像的目录结构需与
+https://windows.php.net/downloads/releases/ 相同（历史版本位于 archives/ 子目录），
+可以是 http(s) 地址、file:// 地址或本地目录。未配置时使用官方地址。`,
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "列出镜像",
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "mirror list 命令不接受参数"); err != nil {
+						return err
+					}
+					if jsonOutput {
+						return printJSON(mirrors())
+					}
+					for i, m := range mirrors() {
+						infof("  %d. %s\n", i+1, m)
+					}
+					return nil
+				},
+			},
+			{
+				name:    "add",
+				args:    "<地址>",
+				summary: "添加镜像（默认添加到末尾）",
+				setup: func(fs *flag.FlagSet) {
+					fs.BoolVar(&first, "first", false, "添加到最前面，优先使用")
+				},
+				run: func(args []string) error {
+					if err := requireArgs(args, 1, 1, "请指定镜像地址，例如：pvm mirror add https://mirror.example.com/php/releases/"); err != nil {
+						return err
+					}
+					m, err := normalizeMirror(args[0])
+					if err != nil {
+						return withExit(exitUsage, err)
+					}
+					list := make([]string, 0, len(mirrors())+1)
+					for _, existing := range mirrors() {
+						if existing != m {
+							list = append(list, existing)
+						}
+					}
+					if first {
+						list = append([]string{m}, list...)
+					} else {
+						list = append(list, m)
+					}
+					cfg.Mirrors = list
+					if err := saveSettings(); err != nil {
+						return err
+					}
+					infof("已添加镜像: %s\n", m)
+					return nil
+				},
+			},
+			{
+				name:        "remove",
+				args:        "<地址>",
+				summary:     "移除镜像",
+				completeArg: func([]string) []string { return mirrors() },
+				run: func(args []string) error {
+					if err := requireArgs(args, 1, 1, "请指定要移除的镜像地址"); err != nil {
+						return err
+					}
+					m, err := normalizeMirror(args[0])
+					if err != nil {
+						return withExit(exitUsage, err)
+					}
+					var list []string
+					for _, existing := range mirrors() {
+						if existing != m {
+							list = append(list, existing)
+						}
+					}
+					if len(list) == len(mirrors()) {
+						return withExit(exitNotFound, fmt.Errorf("未配置镜像 %s", m))
+					}
+					cfg.Mirrors = list
+					if err := saveSettings(); err != nil {
+						return err
+					}
+					infof("已移除镜像: %s\n", m)
+					if len(list) == 0 {
+						infof("未配置任何镜像，将使用官方地址 %s\n", defaultMirror)
+					}
+					return nil
+				},
+			},
+			{
+				name:    "test",
+				summary: "测试各镜像的可用性和延迟",
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "mirror test 命令不接受参数"); err != nil {
+						return err
+					}
+					var results []mirrorResult
+					available := 0
+					for _, m := range mirrors() {
+						r := testMirror(commandCtx, m)
+						results = append(results, r)
+						if r.Available {
+							available++
+						}
+						if jsonOutput {
+							continue
+						}
+						if r.Available {
+							infof("  [可用]   %s  %d ms，%d 个文件\n", m, r.LatencyMS, r.Versions)
+						} else {
+							infof("  [不可用] %s  %s\n", m, r.Error)
+						}
+					}
+					if jsonOutput {
+						if err := printJSON(results); err != nil {
+							return err
+						}
+					}
+					if available == 0 {
+						return withExitReported(exitNetwork, errors.New("没有可用的镜像"))
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// outdated 输出中的一项
+type outdatedEntry struct {
+	Key        string `json:"key"`
+	Dir        string `json:"dir"`
+	Current    string `json:"current"`
+	Latest     string `json:"latest,omitempty"`
+	LatestFile string `json:"latest_file,omitempty"`
+	Outdated   bool   `json:"outdated"`
+}
+
+// 在远程构建中查找与已安装版本同一主次版本、线程安全类型和架构的最新构建
+func latestPatch(builds []phpBuild, r installRecord) (phpBuild, bool) {
+	var latest phpBuild
+	found := false
+	for _, b := range builds {
+		if b.series() != versionSeries(r.Version) {
+			continue
+		}
+		// 正式版本不会更新到预发布版本
+		if isPrerelease(b.Version) && !isPrerelease(r.Version) {
+			continue
+		}
+		if r.Flavour != "" && b.Flavour != r.Flavour || r.Arch != "" && b.Arch != r.Arch {
+			continue
+		}
+		if !found || compareVersions(b.Version, latest.Version) > 0 {
+			latest, found = b, true
+		}
+	}
+	return latest, found
+}
+
+// 比较清单中的每个版本与官网上的最新补丁版本，有可以更新的版本时以 exitCheck 退出
+func checkOutdated(ctx context.Context) error {
+	m, err := loadManifest()
+	if err != nil {
+		return err
+	}
+	if len(m) == 0 {
+		if jsonOutput {
+			return printJSON([]outdatedEntry{})
+		}
+		infof("没有已安装的版本\n")
+		return nil
+	}
+
+	builds, err := remoteBuilds(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return compareVersions(keys[i], keys[j]) < 0 })
+
+	entries := make([]outdatedEntry, 0, len(keys))
+	outdated := 0
+	for _, key := range keys {
+		r := m[key]
+		if r.Version == "" {
+			warnf("无法确定 %s（%s）的版本，跳过\n", key, r.Dir)
+			continue
+		}
+		e := outdatedEntry{Key: key, Dir: r.Dir, Current: r.Version}
+		if latest, ok := latestPatch(builds, r); ok {
+			e.Latest, e.LatestFile = latest.Version, latest.File
+			e.Outdated = compareVersions(latest.Version, r.Version) > 0
+		} else {
+			debugf("官网上没有找到 %s 的构建\n", key)
+		}
+		if e.Outdated {
+			outdated++
+		}
+		entries = append(entries, e)
+	}
+
+	if jsonOutput {
+		if err := printJSON(entries); err != nil {
+			return err
+		}
+	} else {
+		example := ""
+		for _, e := range entries {
+			if e.Outdated {
+				infof("  %-8s %s → %s\n", e.Key, e.Current, e.Latest)
+				if example == "" {
+					example = e.Key
+				}
+			}
+		}
+		if outdated == 0 {
+			infof("所有已安装的版本都是最新的\n")
+		} else {
+			infof("\n使用 pvm install <版本> 安装最新的补丁版本，例如 pvm install %s\n", example)
+		}
+	}
+
+	if outdated > 0 {
+		return withExitReported(exitCheck, fmt.Errorf("有 %d 个版本可以更新", outdated))
+	}
+	return nil
+}
+
+func newOutdatedCommand() *command {
+	return &command{
+		name:    "outdated",
+		summary: "列出有新补丁版本的已安装版本",
+		description: `
+将每个已安装的版本与官网上同一主次版本、线程安全类型和架构的最新补丁版本比较，
+列出可以更新的版本。有可以更新的版本时退出码为 6，可以在 CI 中作为检查使用。`,
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "outdated 命令不接受参数"); err != nil {
+				return err
+			}
+			return checkOutdated(commandCtx)
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 全局输出选项，由命令行参数设置
+var (
+	verbose    bool // 输出调试信息
+	quiet      bool // 只输出错误
+	jsonOutput bool // 以 JSON 格式输出结果
+)
+
+// 共享的标准输入读取器，避免多次确认时丢失缓冲内容
+var stdin = bufio.NewReader(os.Stdin)
+
+// 普通信息的输出位置；JSON 模式下改写到 stderr，保证 stdout 只有 JSON
+func infoWriter() io.Writer {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// 输出普通信息（--quiet 时不输出）
+func infof(format string, a ...interface{}) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(infoWriter(), format, a...)
+}
+
+// 输出调试信息（仅 --verbose 时输出）
+func debugf(format string, a ...interface{}) {
+	if !verbose || quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, a...)
+}
+
+// 输出警告信息（总是写到 stderr）
+func warnf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "警告: "+format, a...)
+}
+
+// 以缩进 JSON 输出结果到 stdout
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// 检查文件是否连接到终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// 向用户确认操作，非交互环境下一律视为拒绝
+func confirm(prompt string) bool {
+	if !isTerminal(os.Stdin) {
+		debugf("标准输入不是终端，跳过确认: %s\n", prompt)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s (y/n): ", prompt)
+	line, _ := stdin.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(line)) == "y"
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PATH 中的一项及检查结果
+type pathEntry struct {
+	Dir       string `json:"dir"`
+	PHP       bool   `json:"php"`       // 目录中有 php 可执行文件
+	Managed   bool   `json:"managed"`   // pvm 管理的 php_home
+	Duplicate bool   `json:"duplicate"` // 与前面的某一项相同
+	Missing   bool   `json:"missing"`   // 目录不存在
+}
+
+// pvm 加入 PATH 的目录：Windows 上为 php_home，其他平台为 php_home/bin
+func managedPathDir() string {
+	if isWindows {
+		return phpHomePath()
+	}
+	return filepath.Join(phpHomePath(), "bin")
+}
+
+// 检查 PATH 中的每一项。引用的变量展开后再比较，Windows 上不区分大小写，
+// $PATH 这样沿用原有 PATH 的引用原样保留
+func analyzePath(value, managed string) []pathEntry {
+	var entries []pathEntry
+	var seen []string
+	for _, p := range filepath.SplitList(value) {
+		if p == "" {
+			continue
+		}
+		e := pathEntry{Dir: p}
+		if strings.HasPrefix(p, "$") && !isWindows {
+			entries = append(entries, e)
+			continue
+		}
+		dir := filepath.Clean(expandEnvRefs(p))
+		e.Managed = samePath(dir, managed)
+		for _, s := range seen {
+			if samePath(s, dir) {
+				e.Duplicate = true
+			}
+		}
+		seen = append(seen, dir)
+		if isDir(dir) {
+			e.PHP = isFile(filepath.Join(dir, phpBinary))
+		} else {
+			e.Missing = true
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// 排在 pvm 目录之前并且带有 php 的目录，这些目录中的 php 会优先于 pvm 管理的版本
+func phpEntriesBefore(value, managed string) []string {
+	var dirs []string
+	for _, e := range analyzePath(value, managed) {
+		if e.Managed {
+			break
+		}
+		if e.PHP && !e.Duplicate {
+			dirs = append(dirs, e.Dir)
+		}
+	}
+	return dirs
+}
+
+// 整理后的 PATH：pvm 目录（已在 PATH 中时）放到最前面，去掉重复的项和 remove 选中的其他 PHP 目录
+func cleanPath(entries []pathEntry, remove func(pathEntry) bool) []string {
+	var result []string
+	for _, e := range entries {
+		if e.Managed && !e.Duplicate {
+			result = append([]string{e.Dir}, result...)
+			continue
+		}
+		if e.Duplicate || (e.PHP && remove(e)) {
+			continue
+		}
+		result = append(result, e.Dir)
+	}
+	return result
+}
+
+// 一项的说明，例如 "(包含 php.exe, 重复)"
+func describeEntry(e pathEntry) string {
+	var notes []string
+	if e.Managed {
+		notes = append(notes, "pvm")
+	} else if e.PHP {
+		notes = append(notes, "包含 "+phpBinary)
+	}
+	if e.Duplicate {
+		notes = append(notes, "重复")
+	}
+	if e.Missing {
+		notes = append(notes, "不存在")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(notes, ", ") + ")"
+}
+
+// 输出修改前后的 PATH：修改前的列表中标出删除的项，修改后的列表中标出新加入或移到最前面的 pvm 目录
+func printPathDiff(before []pathEntry, after []string) {
+	kept := make(map[string]bool)
+	for _, dir := range after {
+		kept[dir] = true
+	}
+	infof("修改前:\n")
+	for _, e := range before {
+		mark := " "
+		if e.Duplicate || !kept[e.Dir] {
+			mark = "-"
+		}
+		infof("  %s %s%s\n", mark, e.Dir, describeEntry(e))
+	}
+	infof("修改后:\n")
+	for i, dir := range after {
+		mark := " "
+		if i == 0 && len(before) > 0 && !before[0].Managed && before[0].Dir != dir {
+			mark = "+"
+		}
+		infof("  %s %s\n", mark, dir)
+	}
+}
+
+// 显示 PATH 中的 PHP 目录和重复项
+func checkPath(env EnvManager) error {
+	managed := managedPathDir()
+	scopes := []envScope{scopeUser, scopeSystem}
+	report := make(map[envScope][]pathEntry)
+	for _, scope := range scopes {
+		value, err := env.Get(scope, "PATH")
+		if err != nil {
+			return fmt.Errorf("读取 %s 中的 PATH 失败: %v", env.Location(scope), err)
+		}
+		report[scope] = analyzePath(value, managed)
+	}
+	if !isWindows {
+		// 配置文件中只有 pvm 的区块，实际生效的 PATH 来自当前环境
+		report["current"] = analyzePath(os.Getenv("PATH"), managed)
+		scopes = append(scopes, "current")
+	}
+	if jsonOutput {
+		return printJSON(report)
+	}
+
+	problems := 0
+	for _, scope := range scopes {
+		if scope == "current" {
+			infof("当前环境中的 PATH:\n")
+		} else {
+			infof("%s 中的 PATH:\n", env.Location(scope))
+		}
+		if len(report[scope]) == 0 {
+			infof("  (空)\n")
+		}
+		for _, e := range report[scope] {
+			infof("    %s%s\n", e.Dir, describeEntry(e))
+			if e.Duplicate || (e.PHP && !e.Managed) {
+				problems++
+			}
+		}
+	}
+	if problems > 0 {
+		infof("\n发现 %d 个重复的项或其他 PHP 目录，可以运行 pvm path clean 整理\n", problems)
+	}
+	return nil
+}
+
+// 整理一个作用范围的 PATH：去重、把 pvm 目录放到最前面，并询问是否删除其他 PHP 目录
+func cleanPathScope(ctx context.Context, env EnvManager, scope envScope, removePHP, dryRun, yes bool) error {
+	value, err := env.Get(scope, "PATH")
+	if err != nil {
+		return fmt.Errorf("读取 %s 中的 PATH 失败: %v", env.Location(scope), err)
+	}
+	managed := managedPathDir()
+	entries := analyzePath(value, managed)
+	after := cleanPath(entries, func(e pathEntry) bool {
+		if removePHP {
+			return true
+		}
+		return confirm(fmt.Sprintf("%s 中有 %s，是否从 PATH 中删除？（否则排在 pvm 之后）", e.Dir, phpBinary))
+	})
+
+	var before []string
+	for _, e := range entries {
+		before = append(before, e.Dir)
+	}
+	changed := strings.Join(before, string(os.PathListSeparator)) != strings.Join(after, string(os.PathListSeparator))
+	if jsonOutput {
+		defer printJSON(struct {
+			Scope   envScope `json:"scope"`
+			Before  []string `json:"before"`
+			After   []string `json:"after"`
+			Changed bool     `json:"changed"`
+		}{scope, before, after, changed})
+	}
+	if !changed {
+		infof("%s 中的 PATH 不需要整理\n", env.Location(scope))
+		return nil
+	}
+
+	infof("%s 中的 PATH:\n", env.Location(scope))
+	printPathDiff(entries, after)
+	if dryRun {
+		return nil
+	}
+	if !yes && !confirm("是否应用这些修改？") {
+		return errCanceled
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if err := setPath(env, scope, strings.Join(after, string(os.PathListSeparator))); err != nil {
+		return interrupted(ctx, fmt.Errorf("更新 PATH 失败: %v", err))
+	}
+	infof("PATH 已更新，新开的终端生效\n")
+	if !isWindows {
+		if dirs := phpEntriesBefore(os.Getenv("PATH"), managed); len(dirs) > 0 {
+			infof("当前环境中的 %s 来自其他配置文件，需要手动删除\n", strings.Join(dirs, "、"))
+		}
+	}
+	return nil
+}
+
+func newPathCommand() *command {
+	var removePHP, dryRun, yes bool
+	return &command{
+		name:    "path",
+		summary: "检查和整理 PATH 中的 PHP 目录",
+		description: `
+列出用户和系统 PATH 中的每一项，标出包含 php 的目录、重复的项和不存在的目录。
+Windows 上重复项的比较不区分大小写，%VAR% 这样的引用展开后再比较。`,
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "path 命令不接受参数"); err != nil {
+				return err
+			}
+			return checkPath(newEnvManager())
+		},
+		subcommands: []*command{
+			{
+				name:    "clean",
+				summary: "去掉重复的项，删除或后移其他 PHP 目录",
+				description: `
+整理 --scope 指定的 PATH（默认取 scope 设置）：把 pvm 的目录放到最前面，去掉重复的项，
+并逐个询问是否删除其他包含 php 的目录（例如 XAMPP 或手动安装的 PHP），不删除的排在 pvm 之后。
+应用前显示修改前后的 PATH 并要求确认。`,
+				setup: func(fs *flag.FlagSet) {
+					fs.Var(scopeFlag{&scopeOverride}, "scope", "整理的 PATH: `user` 或 system，默认取 scope 设置")
+					fs.BoolVar(&removePHP, "remove-php", false, "删除所有其他 PHP 目录，不逐个询问")
+					fs.BoolVar(&dryRun, "dry-run", false, "只显示修改前后的 PATH，不修改")
+					fs.BoolVar(&yes, "yes", false, "不要求确认，直接应用")
+					fs.BoolVar(&yes, "y", false, "--yes 的简写")
+				},
+				run: func(args []string) error {
+					if err := requireArgs(args, 0, 0, "path clean 命令不接受参数"); err != nil {
+						return err
+					}
+					return cleanPathScope(commandCtx, newEnvManager(), pathScope(), removePHP, dryRun, yes)
+				},
+			},
+		},
+	}
+}
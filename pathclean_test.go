@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 在根目录下创建 pvm 的目录、带有 php 的目录和普通目录
+func makePathDirs(t *testing.T) (managed, xampp, tools, missing string) {
+	t.Helper()
+	managed = managedPathDir()
+	xampp = filepath.Join(rootDir, "xampp", "php")
+	tools = filepath.Join(rootDir, "tools")
+	missing = filepath.Join(rootDir, "missing")
+	for _, dir := range []string{managed, xampp, tools} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{managed, xampp} {
+		if err := os.WriteFile(filepath.Join(dir, phpBinary), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
+
+func TestAnalyzePath(t *testing.T) {
+	withTestRoot(t)
+	managed, xampp, tools, missing := makePathDirs(t)
+
+	got := analyzePath(joinPath(xampp, tools, "", managed, missing, tools), managed)
+	want := []pathEntry{
+		{Dir: xampp, PHP: true},
+		{Dir: tools},
+		{Dir: managed, PHP: true, Managed: true},
+		{Dir: missing, Missing: true},
+		{Dir: tools, Duplicate: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("analyzePath =\n%+v\nwant\n%+v", got, want)
+	}
+	if dirs := phpEntriesBefore(joinPath(xampp, tools, managed), managed); !reflect.DeepEqual(dirs, []string{xampp}) {
+		t.Errorf("phpEntriesBefore = %v, want [%s]", dirs, xampp)
+	}
+	if dirs := phpEntriesBefore(joinPath(managed, xampp), managed); len(dirs) != 0 {
+		t.Errorf("phpEntriesBefore with pvm first = %v, want none", dirs)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	withTestRoot(t)
+	managed, xampp, tools, missing := makePathDirs(t)
+
+	tests := []struct {
+		name      string
+		list      string
+		removePHP bool
+		want      []string
+	}{
+		{"moves pvm first", joinPath(xampp, tools, managed), false, []string{managed, xampp, tools}},
+		{"removes other php", joinPath(xampp, tools, managed), true, []string{managed, tools}},
+		{"drops duplicates", joinPath(tools, managed, tools, managed), false, []string{managed, tools}},
+		{"keeps missing dirs", joinPath(missing, tools), false, []string{missing, tools}},
+		{"without pvm", joinPath(tools, xampp), false, []string{tools, xampp}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cleanPath(analyzePath(tt.list, managed), func(pathEntry) bool { return tt.removePHP })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cleanPath = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanPathScope(t *testing.T) {
+	withTestRoot(t)
+	managed, xampp, tools, _ := makePathDirs(t)
+
+	env := &fakeEnv{}
+	env.Set(scopeUser, "PATH", joinPath(xampp, tools, managed, tools))
+	if err := cleanPathScope(context.Background(), env, scopeUser, true, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := env.Get(scopeUser, "PATH"); got != joinPath(managed, tools) {
+		t.Errorf("PATH = %q, want %q", got, joinPath(managed, tools))
+	}
+
+	// --dry-run 不修改
+	env.Set(scopeUser, "PATH", joinPath(xampp, managed))
+	if err := cleanPathScope(context.Background(), env, scopeUser, true, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := env.Get(scopeUser, "PATH"); got != joinPath(xampp, managed) {
+		t.Errorf("PATH after dry run = %q", got)
+	}
+}
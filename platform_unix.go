@@ -0,0 +1,74 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PHP 可执行文件名
+const phpBinary = "php"
+
+// 默认的 pvm 根目录
+func defaultRootDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".pvm")
+	}
+	return ".pvm"
+}
+
+// 切换版本：php_home 是指向版本目录的符号链接。先创建临时链接再重命名覆盖，
+// 切换是原子的，中断时 php_home 保持不变
+func activateVersion(ctx context.Context, version, versionDir string) error {
+	phpHomeDir := phpHomePath()
+
+	// 旧版本留下的空目录可以直接删除，非空目录需要用户处理
+	if info, err := os.Lstat(phpHomeDir); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		if err := os.Remove(phpHomeDir); err != nil {
+			return fmt.Errorf("%s 不是符号链接，请先移走它: %v", phpHomeDir, err)
+		}
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return fmt.Errorf("创建根目录失败: %v", err)
+	}
+	link := filepath.Join(rootDir, ".php_home-link")
+	os.Remove(link)
+	if err := os.Symlink(versionDir, link); err != nil {
+		return fmt.Errorf("创建符号链接失败: %v", err)
+	}
+	if err := os.Rename(link, phpHomeDir); err != nil {
+		os.Remove(link)
+		return fmt.Errorf("切换 php_home 失败: %v", err)
+	}
+	debugf("%s -> %s\n", phpHomeDir, versionDir)
+
+	// 在 shell 配置文件中加入 php_home/bin，之后新开的终端都会使用当前版本
+	binDir := managedPathDir()
+	if err := addToPath(ctx, newEnvManager(), pathScope(), binDir); err != nil {
+		return err
+	}
+	if !pathContains(os.Getenv("PATH"), binDir) {
+		infof("\n新开的终端会使用这个版本，在当前终端中运行下面的命令立即生效:\n")
+		infof("  eval \"$(pvm env)\"\n\n")
+	}
+	return nil
+}
+
+// 当前使用的版本目录，php_home 不是符号链接时返回空字符串
+func currentDir() string {
+	target, err := os.Readlink(phpHomePath())
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(rootDir, target)
+	}
+	return filepath.Clean(target)
+}
@@ -0,0 +1,198 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PHP 可执行文件名
+const phpBinary = "php.exe"
+
+// 默认的 pvm 根目录
+func defaultRootDir() string {
+	return "D:\\app\\pvm"
+}
+
+// php_home 中记录对应版本目录名的文件
+const currentMarker = ".pvm-current"
+
+// 切换版本：把版本目录复制到 php_home，并确保 php_home 位于 PATH 中
+func activateVersion(ctx context.Context, version, versionDir string) error {
+	// PHP_HOME 目录路径
+	phpHomeDir := phpHomePath()
+
+	// 先复制到临时目录，完成后再替换 php_home，中断时 php_home 保持不变
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return fmt.Errorf("创建根目录失败: %v", err)
+	}
+	staging, err := os.MkdirTemp(rootDir, ".php_home-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(staging)
+	os.Chmod(staging, 0755)
+
+	// 使用手动文件复制方法而不是xcopy
+	infof("正在将PHP文件从 %s 复制到 %s\n", versionDir, phpHomeDir)
+
+	// 枚举源目录中的所有文件
+	err = copyDirectory(ctx, versionDir, staging)
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if err != nil {
+		warnf("复制文件失败: %v\n", err)
+		debugf("尝试使用robocopy命令...\n")
+
+		// 如果Go的文件复制方法失败，尝试使用robocopy命令
+		robocopyCmd := exec.CommandContext(ctx, "robocopy", versionDir, staging, "/E", "/NFL", "/NDL")
+		output, err := robocopyCmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		if err != nil {
+			// robocopy的返回码不是标准的0=成功，需要特殊处理
+			exitCode := robocopyCmd.ProcessState.ExitCode()
+			if exitCode >= 8 {
+				debugf("robocopy失败，返回码: %d, 输出: %s\n", exitCode, string(output))
+
+				// 最后尝试使用批处理文件进行复制
+				debugf("尝试使用批处理文件进行复制...\n")
+				copyBat := filepath.Join(os.TempDir(), "pvm_copy.bat")
+				copyContent := fmt.Sprintf(`@echo off
+echo 正在复制PHP文件...
+md "%s" 2>nul
+xcopy "%s\*.*" "%s\" /E /I /Y
+if errorlevel 1 (
+  echo 复制失败
+  exit /b 1
+)
+echo 复制成功
+`, staging, versionDir, staging)
+
+				if err := os.WriteFile(copyBat, []byte(copyContent), 0644); err != nil {
+					return fmt.Errorf("创建复制批处理文件失败: %v", err)
+				}
+				defer os.Remove(copyBat)
+
+				copyCmd := exec.CommandContext(ctx, "cmd", "/C", copyBat)
+				output, err = copyCmd.CombinedOutput()
+				if err != nil {
+					return interrupted(ctx, fmt.Errorf("批处理复制失败: %v, 输出: %s", err, string(output)))
+				}
+			}
+		}
+	}
+
+	debugf("文件复制成功\n")
+
+	// 记录 php_home 对应的版本目录，供 list 和 current 使用
+	if err := os.WriteFile(filepath.Join(staging, currentMarker), []byte(filepath.Base(versionDir)), 0644); err != nil {
+		warnf("记录当前版本失败: %v\n", err)
+	}
+
+	// 创建一个批处理文件，用于在需要时刷新环境变量
+	refreshBat := filepath.Join(staging, "refresh_env.bat")
+	refreshContent := fmt.Sprintf(`@echo off
+echo 当前PHP版本: %s
+php -v
+`, version)
+	if err := os.WriteFile(refreshBat, []byte(refreshContent), 0644); err != nil {
+		warnf("创建刷新脚本失败: %v\n", err)
+	}
+
+	// 替换 php_home
+	debugf("替换目录: %s\n", phpHomeDir)
+	swap, err := replaceDir(ctx, staging, phpHomeDir)
+	if err != nil {
+		return err
+	}
+
+	// 更新 PATH 环境变量（只添加php_home目录）
+	if err := updatePATH(ctx, versionDir); err != nil {
+		// 中断时恢复原来的 php_home
+		if ctx.Err() != nil {
+			swap.rollback()
+			return errInterrupted
+		}
+		swap.commit()
+		return err
+	}
+	swap.commit()
+	infof("环境变量已设置，当前会话和未来会话都将使用 PHP %s\n", version)
+	return nil
+}
+
+// 当前使用的版本目录，php_home 中没有记录时返回空字符串
+func currentDir() string {
+	data, err := os.ReadFile(filepath.Join(phpHomePath(), currentMarker))
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(phpsPath(), strings.TrimSpace(string(data)))
+}
+
+// 确保 php_home 在用户或系统 PATH 中，并为当前会话准备切换脚本
+func updatePATH(ctx context.Context, phpHome string) error {
+	// 符号链接目标目录
+	phpHomeDir := phpHomePath()
+
+	env, scope := newEnvManager(), pathScope()
+	if err := addToPath(ctx, env, scope, phpHomeDir); err != nil {
+		return err
+	}
+	if scope == scopeUser {
+		warnShadowed(env, phpHomeDir)
+	}
+
+	// 创建用于在当前窗口直接运行的批处理文件
+	debugf("为当前会话创建临时环境变量更新脚本...\n")
+	currSessionBat := filepath.Join(os.TempDir(), "pvm_current_session.bat")
+	currSessionContent := fmt.Sprintf(`@echo off
+echo Setting PATH environment variable for current session...
+set "PATH=%s;%%PATH%%"
+echo Current PHP version:
+php -v
+echo.
+echo Press any key to continue...
+pause > nul
+`, phpHomeDir)
+
+	if err := os.WriteFile(currSessionBat, []byte(currSessionContent), 0644); err != nil {
+		warnf("创建当前会话环境变量更新文件失败: %v\n", err)
+	} else {
+		// 立即运行此文件
+		infof("正在使用新 PHP 启动命令提示符...\n")
+
+		// 修复命令语法，避免特殊字符问题
+		batLauncher := filepath.Join(os.TempDir(), "pvm_launch.bat")
+		launchContent := fmt.Sprintf(`@echo off
+cd /d "%s"
+set "PATH=%s;%%PATH%%"
+echo PHP environment set to %s
+echo.
+php -v
+`, phpHome, phpHomeDir, filepath.Base(phpHome))
+
+		if err := os.WriteFile(batLauncher, []byte(launchContent), 0644); err != nil {
+			warnf("创建启动脚本失败: %v\n", err)
+		} else {
+			// 使用简单命令启动批处理文件
+			startCmd := exec.Command("cmd", "/C", "start", "cmd", "/K", batLauncher)
+			startCmd.Start()
+		}
+
+		infof("\n当前会话的 PHP 路径尚未更新。\n")
+		infof("您有两个选择:\n")
+		infof("1. 使用刚刚打开的新命令提示符窗口\n")
+		infof("2. 运行以下命令更新当前窗口: %s\n\n", currSessionBat)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// 官方的预发布版本（alpha、beta、RC）目录
+const defaultQAURL = "https://windows.php.net/downloads/qa/"
+
+// 允许选择预发布版本，由 install 和 ls-remote 的 --pre 设置。
+// 没有设置时，8.4 这样的版本号和约束只会选择正式版本
+var includePrerelease bool
+
+// 预发布版本目录，可以通过 qa_url 设置
+func qaURL() string {
+	if cfg.QAURL != "" {
+		return cfg.QAURL
+	}
+	return defaultQAURL
+}
+
+// 预发布目录中的一个构建和它所在的目录
+type prereleaseBuild struct {
+	phpBuild
+	base string
+}
+
+// 读取预发布目录和快照目录（设置了 snapshot_url 时）中的所有构建
+func prereleaseBuilds(ctx context.Context) ([]prereleaseBuild, error) {
+	bases := []string{qaURL()}
+	if cfg.SnapshotURL != "" {
+		bases = append(bases, cfg.SnapshotURL)
+	}
+	var builds []prereleaseBuild
+	var lastErr error
+	for _, base := range bases {
+		listing, err := readIndexPage(ctx, base)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, errInterrupted
+			}
+			if !offline {
+				warnf("获取预发布版本列表 %s 失败: %v\n", base, err)
+			}
+			lastErr = err
+			continue
+		}
+		for _, b := range parseIndexBuilds(listing) {
+			builds = append(builds, prereleaseBuild{b, base})
+		}
+	}
+	if builds == nil && lastErr != nil {
+		return nil, withExit(exitCodeOf(lastErr), fmt.Errorf("获取预发布版本列表失败: %v", lastErr))
+	}
+	return builds, nil
+}
+
+// 在预发布目录中查找匹配的最新构建。want 可以是 8.4.0RC2 这样的预发布版本号、
+// 8.4-dev 这样的快照，或者使用 --pre 时的 8.4
+func resolvePrerelease(ctx context.Context, want string) (prereleaseBuild, bool, error) {
+	want = normalizeVersion(want)
+	if isSnapshot(want) && cfg.SnapshotURL == "" {
+		return prereleaseBuild{}, false, usageErrorf("没有设置快照目录，请先运行 pvm config set snapshot_url <地址>")
+	}
+	builds, err := prereleaseBuilds(ctx)
+	if err != nil {
+		return prereleaseBuild{}, false, err
+	}
+
+	var best prereleaseBuild
+	found := false
+	for _, b := range builds {
+		var ok bool
+		switch {
+		case isSnapshot(want):
+			ok = isSnapshot(b.Version) && b.series() == versionSeries(want)
+		case isPrerelease(want):
+			ok = b.Version == want
+		default:
+			ok = !isSnapshot(b.Version) && versionMatches(b.Version, want)
+		}
+		if ok && (!found || preferBuild(b.phpBuild, best.phpBuild)) {
+			best, found = b, true
+		}
+	}
+	return best, found, nil
+}
+
+// 下载预发布版本或快照。使用 --pre 安装 8.4 这样的版本时，
+// 正式版本不比预发布版本旧的话返回 ok 为 false，由调用方按正式版本下载
+func downloadPrerelease(ctx context.Context, cache *downloadCache, version string) (string, string, bool, error) {
+	b, found, err := resolvePrerelease(ctx, version)
+	if err != nil {
+		// 使用 --pre 时预发布目录不可用，仍然可以安装正式版本
+		if isPrerelease(version) || exitCodeOf(err) != exitNetwork {
+			return "", "", false, err
+		}
+		return "", "", false, nil
+	}
+	if !isPrerelease(version) {
+		if !found {
+			debugf("没有找到 %s 的预发布版本，使用正式版本\n", version)
+			return "", "", false, nil
+		}
+		if stable, err := getLatestVersion(ctx, version); err == nil && compareVersions(stable, b.Version) >= 0 {
+			debugf("正式版本 %s 不比预发布版本 %s 旧，使用正式版本\n", stable, b.Version)
+			return "", "", false, nil
+		} else if ctx.Err() != nil {
+			return "", "", false, errInterrupted
+		}
+	} else if !found {
+		return "", "", false, withExit(exitNotFound, fmt.Errorf("找不到预发布版本 %s\n使用 pvm ls-remote --pre 查看可用的预发布版本和快照", version))
+	}
+
+	infof("找到预发布版本: %s\n", b.Version)
+	// 快照的文件名不变，内容每次构建都会更新，不使用缓存的文件
+	if isSnapshot(b.Version) {
+		cache.forget(b.File)
+	}
+	url, file, err := downloadFromMirror(ctx, cache, b.base, []string{b.File})
+	if err != nil {
+		return "", "", false, err
+	}
+	if url == "" {
+		return "", "", false, withExit(exitNetwork, errors.New("下载失败，预发布目录中的文件已不存在"))
+	}
+	return file, trimArchiveExt(path.Base(url)), true, nil
+}
+
+// 目录地址类设置项可以使用本地目录，与镜像一样规范化为 file:// 地址
+func dirURLSetter(p *string) func(string) error {
+	return func(v string) error {
+		if v == "" {
+			*p = ""
+			return nil
+		}
+		m, err := normalizeMirror(v)
+		if err != nil {
+			return err
+		}
+		*p = m
+		return nil
+	}
+}
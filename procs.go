@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 正在运行的进程
+type processInfo struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+	Exe  string `json:"exe"`
+}
+
+// 有进程占用目录时的处理方式
+const (
+	busyAbort = "abort" // 取消操作
+	busyWait  = "wait"  // 等待进程退出
+	busyStop  = "stop"  // 结束进程
+)
+
+// --busy 参数，为空时在终端中询问，非交互环境下取消
+var busyAction string
+
+// 为修改 php_home 或版本目录的命令添加 --busy 参数
+func busyFlag(fs *flag.FlagSet) {
+	fs.Func("busy", "有进程正在使用要修改的目录时: `abort`（取消）、wait（等待退出）或 stop（结束进程），默认询问", func(v string) error {
+		switch v {
+		case busyAbort, busyWait, busyStop:
+			busyAction = v
+			return nil
+		}
+		return fmt.Errorf("无效的取值: %s，可选 abort、wait 或 stop", v)
+	})
+}
+
+// 结束进程后等待其退出的时间
+const stopTimeout = 10 * time.Second
+
+// path 是否位于 dir 中
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// 可执行文件位于 dirs 中某个目录下的进程。目录是符号链接时同时比较链接指向的目录
+func processesUnder(dirs []string) ([]processInfo, error) {
+	var roots []string
+	for _, d := range dirs {
+		roots = append(roots, filepath.Clean(d))
+		if real, err := filepath.EvalSymlinks(d); err == nil && real != d {
+			roots = append(roots, real)
+		}
+	}
+	procs, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	var found []processInfo
+	for _, p := range procs {
+		if p.Exe == "" || p.PID == os.Getpid() {
+			continue
+		}
+		exe := filepath.Clean(p.Exe)
+		for _, root := range roots {
+			if isWindows {
+				exe, root = strings.ToLower(exe), strings.ToLower(root)
+			}
+			if isUnder(exe, root) {
+				found = append(found, p)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// 修改 dirs 之前检查是否有进程正在使用其中的程序（例如 php-cgi、开发服务器或 IDE 启动的 php），
+// 有的话按 --busy 参数或用户的选择等待、结束进程或取消操作。无法列出进程时不做检查
+func ensureNotBusy(ctx context.Context, dirs ...string) error {
+	procs, err := processesUnder(dirs)
+	if err != nil {
+		debugf("无法列出正在运行的进程: %v\n", err)
+		return nil
+	}
+	if len(procs) == 0 {
+		return nil
+	}
+	warnf("以下进程正在使用 %s 中的程序:\n", strings.Join(dirs, "、"))
+	for _, p := range procs {
+		fmt.Fprintf(os.Stderr, "  %6d  %s\n", p.PID, p.Exe)
+	}
+
+	action := busyAction
+	if action == "" {
+		action = chooseBusyAction()
+	}
+	switch action {
+	case busyWait:
+		infof("等待这些进程退出，按 Ctrl+C 取消...\n")
+		return waitForProcesses(ctx, dirs, 0)
+	case busyStop:
+		for _, p := range procs {
+			if err := stopProcess(p.PID); err != nil {
+				warnf("结束进程 %d 失败: %v\n", p.PID, err)
+			} else {
+				infof("已结束进程 %d（%s）\n", p.PID, p.Name)
+			}
+		}
+		return waitForProcesses(ctx, dirs, stopTimeout)
+	}
+	return withExit(exitCanceled, errors.New("操作已取消，请先关闭这些进程，或使用 --busy wait / --busy stop"))
+}
+
+// 询问如何处理占用目录的进程，非交互环境下取消
+func chooseBusyAction() string {
+	if !isTerminal(os.Stdin) {
+		return busyAbort
+	}
+	fmt.Fprintf(os.Stderr, "等待进程退出 (w)、结束进程 (s) 还是取消 (a)？[a]: ")
+	line, _ := stdin.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "w", "wait":
+		return busyWait
+	case "s", "stop":
+		return busyStop
+	}
+	return busyAbort
+}
+
+// 等待 dirs 中的进程全部退出，timeout 为 0 时一直等待到中断
+func waitForProcesses(ctx context.Context, dirs []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		procs, err := processesUnder(dirs)
+		if err != nil || len(procs) == 0 {
+			return nil
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			return fmt.Errorf("%d 个进程在 %s 内没有退出", len(procs), timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return errInterrupted
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
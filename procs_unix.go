@@ -0,0 +1,66 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 列出正在运行的进程：Linux 上读取 /proc/<pid>/exe，没有 /proc 时（macOS）使用 ps
+func listProcesses() ([]processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return listProcessesPS()
+	}
+	var procs []processInfo
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// 其他用户的进程没有权限读取，跳过
+		exe, err := os.Readlink(filepath.Join("/proc", e.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		exe = strings.TrimSuffix(exe, " (deleted)")
+		procs = append(procs, processInfo{PID: pid, Name: filepath.Base(exe), Exe: exe})
+	}
+	return procs, nil
+}
+
+// macOS 的 ps 在 comm 列显示可执行文件的完整路径
+func listProcessesPS() ([]processInfo, error) {
+	output, err := exec.Command("ps", "-axo", "pid=,comm=").Output()
+	if err != nil {
+		return nil, err
+	}
+	var procs []processInfo
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		exe := strings.TrimSpace(fields[1])
+		procs = append(procs, processInfo{PID: pid, Name: filepath.Base(exe), Exe: exe})
+	}
+	return procs, nil
+}
+
+// 发送 SIGTERM 结束进程，让 php-fpm 等程序可以正常退出
+func stopProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
+}
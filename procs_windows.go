@@ -0,0 +1,63 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// 列出正在运行的进程及其可执行文件的完整路径。没有权限查询的进程（例如其他用户的服务）路径为空
+func listProcesses() ([]processInfo, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var procs []processInfo
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		procs = append(procs, processInfo{
+			PID:  int(entry.ProcessID),
+			Name: syscall.UTF16ToString(entry.ExeFile[:]),
+			Exe:  processImage(entry.ProcessID),
+		})
+	}
+	return procs, nil
+}
+
+// 进程的可执行文件路径，无法查询时返回空字符串
+func processImage(pid uint32) string {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(h)
+	buf := make([]uint16, syscall.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	r, _, _ := procQueryFullProcessImageNameW.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:size])
+}
+
+// 结束进程。Windows 上没有可以让进程正常退出的信号，直接终止
+func stopProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	return p.Kill()
+}
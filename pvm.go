@@ -1,81 +1,60 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-const (
-	phpBaseURL = "https://windows.php.net/downloads/releases/archives/"
-	phpNewURL  = "https://windows.php.net/downloads/releases/"
-)
+// pvm 根目录，phps 与 php_home 都位于其下
+var rootDir string
 
-func init() {
-	// 检查临时目录
-	tmpDir := filepath.Join(os.TempDir(), "pvm")
-	os.MkdirAll(tmpDir, 0755)
+// 确定根目录：--root 参数优先，其次是环境变量 PVM_ROOT
+func initRoot() error {
+	rootDir = rootFlag
+	if rootDir == "" {
+		rootDir = os.Getenv("PVM_ROOT")
+	}
+	if rootDir == "" {
+		rootDir = defaultRootDir()
+	}
+	abs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return fmt.Errorf("无效的根目录 %s: %v", rootDir, err)
+	}
+	rootDir = abs
+	debugf("pvm 根目录: %s\n", rootDir)
+	return nil
+}
 
-	// 显示欢迎信息
-	fmt.Println("PVM - PHP 版本管理器")
-	fmt.Println("===================")
+// 各版本的安装目录
+func phpsPath() string {
+	return filepath.Join(rootDir, "phps")
+}
 
-	// 获取 PHP 安装目录
-	phpHome, err := getPHPHome()
-	if err == nil {
-		fmt.Printf("PHP 目录: %s\n", phpHome)
-	}
+// 当前使用版本的目录（加入 PATH 的目录）
+func phpHomePath() string {
+	return filepath.Join(rootDir, "php_home")
 }
 
-func main() {
-	// 获取命令行参数
-	args := os.Args[1:]
-
-	// 如果没有参数，执行默认的更新操作
-	if len(args) == 0 {
-		fmt.Println("使用说明：")
-		fmt.Println("  pvm list - 列出所有已安装的版本")
-		fmt.Println("  pvm install <版本> - 安装指定版本")
-		fmt.Println("  pvm use <版本> - 切换到指定版本")
-		fmt.Println("  pvm check - 查看PHP官网上可用的版本")
-		fmt.Println("  pvm - 显示帮助信息")
-		return
-	}
+// 缓存目录
+func cachePath() string {
+	return filepath.Join(rootDir, "cache")
+}
 
-	// 处理各种命令
-	switch args[0] {
-	case "list":
-		listVersions()
-	case "install":
-		if len(args) < 2 {
-			fmt.Println("请指定要安装的版本，例如：pvm install 7.4")
-			fmt.Println("您可以使用 pvm check 命令查看可用的版本")
-			return
-		}
-		installVersion(args[1])
-	case "use":
-		if len(args) < 2 {
-			fmt.Println("请指定要使用的版本，例如：pvm use 7.4")
-			fmt.Println("您可以使用 pvm list 命令查看已安装的版本")
-			return
-		}
-		useVersion(args[1])
-	case "check":
-		checkAvailableVersions()
-	default:
-		fmt.Println("未知命令。可用命令：")
-		fmt.Println("  pvm list - 列出所有已安装的版本")
-		fmt.Println("  pvm install <版本> - 安装指定版本")
-		fmt.Println("  pvm use <版本> - 切换到指定版本")
-		fmt.Println("  pvm check - 查看PHP官网上可用的版本")
-	}
+func main() {
+	os.Exit(runCLI(os.Args[1:]))
 }
 
 func updateProgram() {
@@ -115,551 +94,674 @@ func updateProgram() {
 }
 
 func getPHPHome() (string, error) {
-	// 使用固定的 PHP 安装目录
-	phpsDir := "D:\\app\\pvm\\phps"
-	phpHomeDir := "D:\\app\\pvm\\php_home"
+	phpsDir := phpsPath()
+	phpHomeDir := phpHomePath()
 
 	// 创建 phps 目录
-	fmt.Printf("使用 PHP 目录: %s\n", phpsDir)
+	debugf("使用 PHP 目录: %s\n", phpsDir)
 	if err := os.MkdirAll(phpsDir, 0755); err != nil {
 		return "", fmt.Errorf("创建 phps 目录失败: %v", err)
 	}
 
-	// 创建 php_home 目录
-	if err := os.MkdirAll(phpHomeDir, 0755); err != nil {
-		return "", fmt.Errorf("创建 php_home 目录失败: %v", err)
+	// 创建 php_home 目录，其他平台上 php_home 是切换版本时创建的符号链接
+	if isWindows {
+		if err := os.MkdirAll(phpHomeDir, 0755); err != nil {
+			return "", fmt.Errorf("创建 php_home 目录失败: %v", err)
+		}
 	}
 
 	return phpsDir, nil
 }
 
-func listVersions() {
+// list 命令 JSON 输出中的一项
+type listEntry struct {
+	Key       string    `json:"key,omitempty"`
+	Dir       string    `json:"dir"`
+	Version   string    `json:"version,omitempty"`
+	Flavour   string    `json:"flavour,omitempty"`
+	Arch      string    `json:"arch,omitempty"`
+	Toolchain string    `json:"toolchain,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Variants  []string  `json:"variants,omitempty"`
+	Mapped    bool      `json:"mapped"`
+	Current   bool      `json:"current"`
+	Support   string    `json:"support,omitempty"`
+	Size      int64     `json:"size"`
+	Modified  time.Time `json:"modified"`
+}
+
+func listVersions() error {
 	// 获取 PHP 安装目录
 	phpHome, err := getPHPHome()
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		return
+		return err
 	}
 
-	// 版本映射文件
-	versionFile := filepath.Join(phpHome, "versions.json")
-	var versionMap map[string]string
-
-	// 读取版本映射
-	data, err := os.ReadFile(versionFile)
-	if err == nil {
-		// 文件存在，解析 JSON
-		if err := json.Unmarshal(data, &versionMap); err != nil {
-			versionMap = make(map[string]string)
-		}
-	} else {
-		// 文件不存在，创建空映射
-		versionMap = make(map[string]string)
+	// 读取版本清单，损坏时按空清单处理
+	m, err := loadManifest()
+	if err != nil {
+		warnf("%v\n", err)
+		m = make(manifest)
 	}
 
 	// 列出所有 PHP 安装目录
 	dirs, err := filepath.Glob(filepath.Join(phpHome, "php-*"))
 	if err != nil {
-		fmt.Printf("列出目录失败: %v\n", err)
-		return
-	}
-
-	if len(dirs) == 0 {
-		fmt.Println("没有找到任何版本")
-		return
+		return fmt.Errorf("列出目录失败: %v", err)
 	}
 
 	// 获取当前使用的版本
-	currentVersion := getCurrentVersion()
+	currentVersion := currentDir()
 
-	fmt.Println("已安装的 PHP 版本:")
-	for shortVersion, dirName := range versionMap {
-		fullPath := filepath.Join(phpHome, dirName)
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]listEntry, 0)
+	for _, key := range keys {
+		r := m[key]
+		fullPath := filepath.Join(phpHome, r.Dir)
 		info, err := os.Stat(fullPath)
 		if err != nil {
 			continue
 		}
-
-		isCurrent := ""
-		if fullPath == currentVersion {
-			isCurrent = " (当前使用)"
-		}
-
-		fmt.Printf("  %s => %s%s\n", shortVersion, dirName, isCurrent)
-		fmt.Printf("      大小: %d 字节, 修改时间: %s\n", info.Size(), info.ModTime().Format("2006-01-02 15:04:05"))
+		entries = append(entries, listEntry{
+			Key:       key,
+			Dir:       r.Dir,
+			Version:   r.Version,
+			Flavour:   r.Flavour,
+			Arch:      r.Arch,
+			Toolchain: r.Toolchain,
+			Source:    r.Source,
+			Variants:  r.Variants,
+			Mapped:    true,
+			Current:   fullPath == currentVersion,
+			Size:      info.Size(),
+			Modified:  info.ModTime(),
+		})
 	}
 
 	// 列出未映射的目录
-	unmapped := make([]string, 0)
 	for _, dir := range dirs {
 		dirName := filepath.Base(dir)
-		found := false
-		for _, mappedDir := range versionMap {
-			if mappedDir == dirName {
-				found = true
-				break
-			}
+		if _, found := m.findDir(dirName); found {
+			continue
+		}
+		entry := listEntry{Dir: dirName, Current: dir == currentVersion}
+		if b, ok := parseBuildName(dirName); ok {
+			entry.Version, entry.Flavour, entry.Arch, entry.Toolchain = b.Version, b.Flavour, b.Arch, b.Toolchain
 		}
-		if !found {
-			unmapped = append(unmapped, dirName)
+		if info, err := os.Stat(dir); err == nil {
+			entry.Size, entry.Modified = info.Size(), info.ModTime()
 		}
+		entries = append(entries, entry)
 	}
 
-	if len(unmapped) > 0 {
-		fmt.Println("\n未映射的 PHP 安装目录:")
-		for _, dirName := range unmapped {
-			fullPath := filepath.Join(phpHome, dirName)
-			isCurrent := ""
-			if fullPath == currentVersion {
-				isCurrent = " (当前使用)"
-			}
-			fmt.Printf("  %s%s\n", dirName, isCurrent)
+	for i := range entries {
+		if entries[i].Version != "" {
+			entries[i].Support, _ = supportStatus(versionSeries(entries[i].Version), time.Now())
 		}
 	}
-}
 
-func getLatestVersion(majorMinor string) (string, error) {
-	// 获取目录列表
-	resp, err := http.Get(phpBaseURL)
-	if err != nil {
-		return "", fmt.Errorf("获取版本列表失败: %v", err)
+	if jsonOutput {
+		return printJSON(entries)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("读取版本列表失败: %v", err)
-	}
-
-	// 使用多个正则表达式匹配不同格式的版本号
-	patterns := []string{
-		fmt.Sprintf(`php-%s\.\d+-Win32-vc15-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-Win32-vc16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-Win32-vs16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-nts-Win32-vc15-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-nts-Win32-vc16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-nts-Win32-vs16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-nts-Win32-vs17-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-Win32-vs17-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-Win32-vs16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s\.\d+-Win32-vs17-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-Win32-vc15-x64\.zip`, majorMinor), // 添加没有微版本的模式
-		fmt.Sprintf(`php-%s-Win32-vc16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-Win32-vs16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-Win32-vs17-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-nts-Win32-vc15-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-nts-Win32-vc16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-nts-Win32-vs16-x64\.zip`, majorMinor),
-		fmt.Sprintf(`php-%s-nts-Win32-vs17-x64\.zip`, majorMinor),
-	}
-
-	var matches []string
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		found := re.FindAllString(string(body), -1)
-		matches = append(matches, found...)
-	}
-
-	if len(matches) == 0 {
-		// 尝试搜索当前PHP版本信息
-		tryOtherVersions := fmt.Sprintf(`查找版本 %s 失败。
-尝试以下操作:
-1. 检查版本号是否正确，例如使用 "8.2" 而不是 "8.4"
-2. 如果是最新版本，检查是否需要完整版本号，例如 "8.2.0" 而不是 "8.2"
-3. 使用 "pvm list" 命令查看已安装的版本
-4. 访问 https://windows.php.net/download 查看可用的版本`, majorMinor)
-		return "", fmt.Errorf(tryOtherVersions)
-	}
-
-	// 提取版本号（使用第一个匹配项）
-	version := matches[0]
-	version = strings.TrimPrefix(version, "php-")
-	version = strings.TrimSuffix(version, "-Win32-vc15-x64.zip")
-	version = strings.TrimSuffix(version, "-Win32-vc16-x64.zip")
-	version = strings.TrimSuffix(version, "-Win32-vs16-x64.zip")
-	version = strings.TrimSuffix(version, "-Win32-vs17-x64.zip")
-	version = strings.TrimSuffix(version, "-nts-Win32-vc15-x64.zip")
-	version = strings.TrimSuffix(version, "-nts-Win32-vc16-x64.zip")
-	version = strings.TrimSuffix(version, "-nts-Win32-vs16-x64.zip")
-	version = strings.TrimSuffix(version, "-nts-Win32-vs17-x64.zip")
-
-	return version, nil
-}
-
-func downloadPHP(version string) (string, string, error) {
-	// 获取完整版本号
-	fullVersion, err := getLatestVersion(version)
-	if err != nil {
-		return "", "", err
+	if len(dirs) == 0 {
+		infof("没有找到任何版本\n")
+		return nil
 	}
 
-	fmt.Printf("找到最新版本: %s\n", fullVersion)
-
-	// 尝试不同的下载 URL 格式
-	urls := []string{
-		// 从发布目录下载
-		fmt.Sprintf("%sphp-%s-Win32-vc15-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vc16-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vs16-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vs17-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vc15-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vc16-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vs16-x64.zip", phpNewURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vs17-x64.zip", phpNewURL, fullVersion),
-
-		// 从归档目录下载
-		fmt.Sprintf("%sphp-%s-Win32-vc15-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vc16-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vs16-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vc15-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vc16-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vs16-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-nts-Win32-vs17-x64.zip", phpBaseURL, fullVersion),
-		fmt.Sprintf("%sphp-%s-Win32-vs17-x64.zip", phpBaseURL, fullVersion),
-	}
-
-	var resp *http.Response
-	var downloadErr error
-	var successfulURL string
-
-	fmt.Println("尝试下载以下 URL:")
-	for _, url := range urls {
-		fmt.Printf("  %s\n", url)
-		resp, downloadErr = http.Get(url)
-		if downloadErr == nil && resp.StatusCode == http.StatusOK {
-			fmt.Printf("成功下载: %s\n", url)
-			successfulURL = url
-			break
+	infof("已安装的 PHP 版本:\n")
+	printedUnmapped := false
+	for _, e := range entries {
+		isCurrent := ""
+		if e.Current {
+			isCurrent = " (当前使用)"
 		}
-		if resp != nil {
-			fmt.Printf("  状态码: %d\n", resp.StatusCode)
-			resp.Body.Close()
-		} else {
-			fmt.Printf("  错误: %v\n", downloadErr)
+		if e.Mapped {
+			infof("  %s => %s%s\n", e.Key, e.Dir, isCurrent)
+			if e.Source != "" && e.Source != sourceDownload {
+				source := e.Source
+				for _, v := range e.Variants {
+					source += " +" + v
+				}
+				infof("      来源: %s\n", source)
+			}
+			if e.Support != "" {
+				_, l := supportStatus(versionSeries(e.Version), time.Now())
+				infof("      支持状态: %s\n", formatSupport(e.Support, l))
+			}
+			infof("      大小: %d 字节, 修改时间: %s\n", e.Size, e.Modified.Format("2006-01-02 15:04:05"))
+			continue
 		}
+		if !printedUnmapped {
+			infof("\n未映射的 PHP 安装目录:\n")
+			printedUnmapped = true
+		}
+		infof("  %s%s\n", e.Dir, isCurrent)
 	}
+	return nil
+}
 
-	if successfulURL == "" {
-		return "", "", fmt.Errorf("下载失败，未找到可用的下载链接。\n请访问 https://windows.php.net/download 查看可用的PHP版本。")
+// 当前使用的版本在清单中的名称和完整版本号，未映射的目录名称为空
+func currentSelection(dir string) (string, string) {
+	dirName := filepath.Base(dir)
+	key, version := "", ""
+	if m, err := loadManifest(); err == nil {
+		if k, found := m.findDir(dirName); found {
+			key, version = k, m[k].Version
+		}
 	}
-	defer resp.Body.Close()
-
-	// 获取完整的目录名称
-	parts := strings.Split(successfulURL, "/")
-	filename := parts[len(parts)-1]
-	dirName := strings.TrimSuffix(filename, ".zip")
+	if version == "" {
+		if b, ok := parseBuildName(dirName); ok {
+			version = b.Version
+		}
+	}
+	return key, version
+}
 
-	fmt.Printf("将使用目录名: %s\n", dirName)
+// 当前使用的版本名称，未映射时为目录名，没有当前版本时为空
+func currentKey() string {
+	dir := currentDir()
+	if dir == "" {
+		return ""
+	}
+	if key, _ := currentSelection(dir); key != "" {
+		return key
+	}
+	return filepath.Base(dir)
+}
 
-	// 创建下载目录
-	downloadDir := filepath.Join(os.TempDir(), "pvm")
-	if err := os.MkdirAll(downloadDir, 0755); err != nil {
-		return "", "", fmt.Errorf("创建下载目录失败: %v", err)
+// 显示当前使用的版本
+func showCurrent() error {
+	dir := currentDir()
+	if dir == "" {
+		return withExit(exitNotFound, errors.New("当前没有使用任何版本，请先运行 pvm use <版本>"))
+	}
+	dirName := filepath.Base(dir)
+	key, version := currentSelection(dir)
+
+	if jsonOutput {
+		return printJSON(struct {
+			Key     string `json:"key,omitempty"`
+			Dir     string `json:"dir"`
+			Version string `json:"version,omitempty"`
+			Path    string `json:"path"`
+		}{key, dirName, version, dir})
+	}
+	name := key
+	if name == "" {
+		name = dirName
+	}
+	if version != "" && version != name {
+		fmt.Printf("%s (%s)\n", name, version)
+	} else {
+		fmt.Println(name)
 	}
+	debugf("目录: %s\n", dir)
+	return nil
+}
 
-	outputFile := filepath.Join(downloadDir, filename)
-	fmt.Printf("保存到: %s\n", outputFile)
+func getLatestVersion(ctx context.Context, majorMinor string) (string, error) {
+	version, _, err := findRelease(ctx, majorMinor)
+	return version, err
+}
 
-	// 保存文件
-	out, err := os.Create(outputFile)
+// 在发布目录和归档目录中查找匹配的最新正式版本，返回版本号和该版本按下载优先级排列的压缩包。
+// 支持各个时期的命名方式，例如 php-5.6.40-Win32-VC11-x86.zip、php-7.0.33-nts-Win32-VC14-x64.zip
+// 和 php-8.3.4-Win32-vs16-x64.zip
+func findRelease(ctx context.Context, want string) (string, []string, error) {
+	builds, err := remoteBuilds(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("创建文件失败: %v", err)
+		return "", nil, err
 	}
-	defer out.Close()
 
-	n, err := io.Copy(out, resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("保存文件失败: %v", err)
+	version := ""
+	for _, b := range builds {
+		if isPrerelease(b.Version) || !versionMatches(b.Version, want) {
+			continue
+		}
+		// 静态构建只能使用本机架构
+		if !isWindows && b.Arch != hostArch() {
+			continue
+		}
+		if version == "" || compareVersions(b.Version, version) > 0 {
+			version = b.Version
+		}
 	}
-	fmt.Printf("下载完成，文件大小: %d 字节\n", n)
-
-	// 验证文件是否存在
-	_, err = os.Stat(outputFile)
-	if err != nil {
-		return "", "", fmt.Errorf("下载后文件不存在: %v", err)
+	if version == "" {
+		tryOtherVersions := fmt.Sprintf(`查找版本 %s 失败。
+尝试以下操作:
+1. 检查版本号是否正确，例如使用 "8.2" 而不是 "8.4"
+2. 如果是最新版本，检查是否需要完整版本号，例如 "8.2.0" 而不是 "8.2"
+3. 使用 "pvm list" 命令查看已安装的版本
+4. 访问 https://windows.php.net/download 查看可用的版本`, want)
+		return "", nil, withExit(exitNotFound, errors.New(tryOtherVersions))
 	}
 
-	return outputFile, dirName, nil
+	// 优先 x64 和线程安全版本；只有 x86 构建的旧版本（5.4 及更早）使用 x86
+	var candidates []phpBuild
+	for _, b := range builds {
+		if b.Version == version && (isWindows || b.Arch == hostArch()) {
+			candidates = append(candidates, b)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return preferBuild(candidates[i], candidates[j]) })
+	files := make([]string, len(candidates))
+	for i, b := range candidates {
+		files[i] = b.File
+	}
+	return version, files, nil
 }
 
-func updatePATH(phpHome string) error {
-	// 获取当前 PATH 环境变量（获取系统级别 PATH）
-	cmd := exec.Command("reg", "query", "HKLM\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment", "/v", "PATH")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("获取系统 PATH 环境变量失败: %v", err)
-	}
-
-	// 解析注册表输出获取系统 PATH
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-	var path string
-	for _, line := range lines {
-		if strings.Contains(line, "PATH") && strings.Contains(line, "REG_") {
-			parts := strings.SplitN(line, "REG_", 2)
-			if len(parts) > 1 {
-				regValueParts := strings.SplitN(parts[1], "    ", 2)
-				if len(regValueParts) > 1 {
-					path = strings.TrimSpace(regValueParts[1])
-					break
-				}
-			}
+func downloadPHP(ctx context.Context, cache *downloadCache, version string) (string, string, error) {
+	// 离线模式下优先使用缓存中的文件，没有时只能使用本地镜像
+	if offline {
+		if file, b, ok := cache.findBuild(version); ok {
+			infof("离线模式，使用缓存的 PHP %s: %s\n", b.Version, b.File)
+			return file, b.dirName(), nil
 		}
+		debugf("缓存中没有 PHP %s，尝试本地镜像\n", version)
 	}
 
-	if path == "" {
-		path = os.Getenv("PATH") // 如果无法获取系统 PATH，则使用当前 PATH
-		fmt.Println("无法从注册表获取系统 PATH，使用当前会话的 PATH 作为备用")
+	// 预发布版本和快照从 QA 和快照目录下载
+	if isPrerelease(version) || includePrerelease {
+		if file, dirName, ok, err := downloadPrerelease(ctx, cache, version); ok || err != nil {
+			return file, dirName, err
+		}
 	}
 
-	// 符号链接目标目录
-	phpHomeDir := "D:\\app\\pvm\\php_home"
-
-	// 检查 PHP 目录是否已经在 PATH 中
-	phpInPath := false
-	paths := strings.Split(path, ";")
-	for _, p := range paths {
-		if strings.EqualFold(p, phpHomeDir) {
-			phpInPath = true
-			fmt.Printf("PHP 目录已在系统 PATH 中: %s\n", phpHomeDir)
-			break
-		}
+	// 获取完整版本号和可以下载的压缩包
+	fullVersion, filenames, err := findRelease(ctx, version)
+	if err != nil {
+		return "", "", err
 	}
 
-	if !phpInPath {
-		fmt.Printf("更新系统 PATH 环境变量...\n")
-		fmt.Printf("将 %s 添加到系统 PATH\n", phpHomeDir)
+	infof("找到最新版本: %s\n", fullVersion)
 
-		// 构建新的 PATH（添加到开头）
-		newPath := phpHomeDir
-		if path != "" {
-			newPath = newPath + ";" + path
+	var lastErr error
+	for _, mirror := range downloadMirrors() {
+		debugf("尝试从镜像 %s 下载\n", mirror)
+		url, file, err := downloadFromMirror(ctx, cache, mirror, filenames)
+		if err == nil {
+			// 获取完整的目录名称
+			dirName := trimArchiveExt(path.Base(url))
+			return file, dirName, nil
 		}
-
-		fmt.Println("以管理员权限设置系统 PATH 环境变量...")
-
-		// 创建批处理文件来设置系统环境变量
-		batFile := filepath.Join(os.TempDir(), "pvm_setenv.bat")
-		batContent := fmt.Sprintf(`@echo off
-echo Setting system PATH environment variable...
-setx PATH "%s" /M
-IF %%ERRORLEVEL%% NEQ 0 (
-    echo Error: Failed to set system environment variable!
-    pause
-    exit /b 1
-)
-echo System environment variable updated!
-`, newPath)
-
-		if err := os.WriteFile(batFile, []byte(batContent), 0644); err != nil {
-			return fmt.Errorf("创建批处理文件失败: %v", err)
+		// 被中断时直接停止；网络错误和校验失败（镜像上的文件损坏或过期）换下一个镜像
+		if exitCodeOf(err) == exitCanceled {
+			return "", "", err
 		}
-
-		// 使用 PowerShell 以管理员权限运行批处理文件
-		fmt.Printf("请在弹出的 UAC 提示中选择\"是\"\n")
-		psCmd := fmt.Sprintf(`Start-Process -FilePath "%s" -Verb RunAs -Wait`, batFile)
-		cmd = exec.Command("powershell", "-Command", psCmd)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("更新系统 PATH 环境变量失败: %v, 输出: %s", err, string(output))
+		if exitCodeOf(err) == exitChecksum {
+			warnf("镜像 %s 上的文件有误: %v，尝试下一个镜像\n", mirror, err)
+		} else if url != "" {
+			warnf("镜像 %s 不可用: %v，尝试下一个镜像\n", mirror, err)
 		}
+		lastErr = err
+	}
 
-		fmt.Printf("系统 PATH 环境变量已永久更新!\n")
+	var statusErr *httpStatusError
+	if errors.As(lastErr, &statusErr) || lastErr == nil {
+		return "", "", withExit(exitNetwork, errors.New("下载失败，未找到可用的下载链接。\n请访问 https://windows.php.net/download 查看可用的PHP版本。"))
+	}
+	if exitCodeOf(lastErr) == exitChecksum {
+		return "", "", withExit(exitChecksum, fmt.Errorf("下载失败，镜像上的文件没有通过校验: %v", lastErr))
 	}
+	return "", "", withExit(exitNetwork, fmt.Errorf("下载失败，所有镜像都不可用: %v", lastErr))
+}
 
-	// 创建用于在当前窗口直接运行的批处理文件
-	fmt.Println("为当前会话创建临时环境变量更新脚本...")
-	currSessionBat := filepath.Join(os.TempDir(), "pvm_current_session.bat")
-	currSessionContent := fmt.Sprintf(`@echo off
-echo Setting PATH environment variable for current session...
-set "PATH=%s;%%PATH%%"
-echo Current PHP version:
-php -v
-echo.
-echo Press any key to continue...
-pause > nul
-`, phpHomeDir)
+// 在一个镜像的发布目录和归档目录中依次查找并下载文件。
+// 返回下载地址和本地文件；所有文件都不存在时返回的地址为空
+func downloadFromMirror(ctx context.Context, cache *downloadCache, mirror string, filenames []string) (string, string, error) {
+	var lastErr error
+	for _, dir := range []string{"", archivesDir} {
+		for _, filename := range filenames {
+			url := mirror + dir + filename
+
+			// 校验和一致的缓存文件直接重用
+			if cached, ok := cache.lookup(ctx, url); ok {
+				infof("使用缓存的下载文件: %s\n", filename)
+				return url, cached, nil
+			}
 
-	if err := os.WriteFile(currSessionBat, []byte(currSessionContent), 0644); err != nil {
-		fmt.Printf("警告: 创建当前会话环境变量更新文件失败: %v\n", err)
-	} else {
-		// 立即运行此文件
-		fmt.Println("正在使用新 PHP 启动命令提示符...")
-
-		// 修复命令语法，避免特殊字符问题
-		batLauncher := filepath.Join(os.TempDir(), "pvm_launch.bat")
-		launchContent := fmt.Sprintf(`@echo off
-cd /d "%s"
-set "PATH=%s;%%PATH%%"
-echo PHP environment set to %s
-echo.
-php -v
-`, phpHome, phpHomeDir, filepath.Base(phpHome))
-
-		if err := os.WriteFile(batLauncher, []byte(launchContent), 0644); err != nil {
-			fmt.Printf("警告: 创建启动脚本失败: %v\n", err)
-		} else {
-			// 使用简单命令启动批处理文件
-			startCmd := exec.Command("cmd", "/C", "start", "cmd", "/K", batLauncher)
-			startCmd.Start()
+			debugf("  %s\n", url)
+			outputFile, err := cache.fetch(ctx, url)
+			if err != nil {
+				// 文件不存在时尝试下一个链接，重试后仍失败的网络错误换下一个镜像
+				var statusErr *httpStatusError
+				if errors.As(err, &statusErr) && !isTransient(err) {
+					debugf("  状态码: %d\n", statusErr.status)
+					lastErr = err
+					continue
+				}
+				return url, "", err
+			}
+			infof("成功下载: %s\n", url)
+			debugf("保存到: %s\n", outputFile)
+			return url, outputFile, nil
 		}
-
-		fmt.Printf("\n当前会话的 PHP 路径尚未更新。\n")
-		fmt.Printf("您有两个选择:\n")
-		fmt.Printf("1. 使用刚刚打开的新命令提示符窗口\n")
-		fmt.Printf("2. 运行以下命令更新当前窗口: %s\n\n", currSessionBat)
 	}
-
-	return nil
+	return "", "", lastErr
 }
 
-func extractZip(zipFile, destDir string) error {
+func extractZip(ctx context.Context, zipFile, destDir string) error {
 	// 确保目标目录存在
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return fmt.Errorf("创建目标目录失败: %v", err)
 	}
 
-	fmt.Printf("解压 %s 到 %s\n", zipFile, destDir)
+	debugf("解压 %s 到 %s\n", zipFile, destDir)
 
 	// 使用 7zip 解压（如果有的话）
-	sevenZipCmd := exec.Command("7z", "x", "-o"+destDir, "-y", zipFile)
+	sevenZipCmd := exec.CommandContext(ctx, "7z", "x", "-o"+destDir, "-y", zipFile)
 	output, err := sevenZipCmd.CombinedOutput()
 	if err == nil {
-		fmt.Printf("7zip 解压成功\n")
+		debugf("7zip 解压成功\n")
 		return nil
 	}
 
-	fmt.Printf("7zip 解压失败: %v, 尝试 PowerShell...\n", err)
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	debugf("7zip 解压失败: %v, 尝试 PowerShell...\n", err)
 
 	// 如果 7zip 失败，使用 PowerShell
-	psCmd := exec.Command("powershell", "-Command", fmt.Sprintf(
+	psCmd := exec.CommandContext(ctx, "powershell", "-Command", fmt.Sprintf(
 		`Expand-Archive -Path "%s" -DestinationPath "%s" -Force`,
 		zipFile, destDir))
 
 	// 捕获命令输出
 	output, err = psCmd.CombinedOutput()
 	if err != nil {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
 		// 如果 PowerShell 也失败，尝试使用 unzip 命令
-		fmt.Printf("PowerShell 解压失败: %v, 尝试 unzip...\n", err)
+		debugf("PowerShell 解压失败: %v, 尝试 unzip...\n", err)
 
-		unzipCmd := exec.Command("unzip", "-o", zipFile, "-d", destDir)
+		unzipCmd := exec.CommandContext(ctx, "unzip", "-o", zipFile, "-d", destDir)
 		output, err = unzipCmd.CombinedOutput()
 		if err != nil {
-			return fmt.Errorf("所有解压方法都失败: %v, 输出: %s", err, string(output))
+			return interrupted(ctx, fmt.Errorf("所有解压方法都失败: %v, 输出: %s", err, string(output)))
 		}
 	}
 
-	fmt.Printf("解压完成\n")
+	infof("解压完成\n")
 	return nil
 }
 
-func installVersion(version string) {
-	// 获取 PHP 安装目录
-	phpHome, err := getPHPHome()
-	if err != nil {
-		fmt.Printf("%v\n", err)
-		return
+func installVersion(ctx context.Context, version string) error {
+	version = normalizeVersion(version)
+
+	// 清理以前运行残留的临时文件
+	cleanTempArtifacts(staleTempAge)
+
+	if err := checkLifecycle(versionSeries(version)); err != nil {
+		return err
 	}
 
 	// 下载 PHP
-	fmt.Printf("正在下载 PHP %s...\n", version)
-	downloadedFile, dirName, err := downloadPHP(version)
+	infof("正在下载 PHP %s...\n", version)
+	cache, err := openDownloadCache()
 	if err != nil {
-		fmt.Printf("下载失败: %v\n", err)
-		return
+		return err
 	}
-	fmt.Printf("下载完成，正在安装...\n")
+	downloadedFile, record, err := fetchRelease(ctx, cache, version)
+	if err != nil {
+		return err
+	}
+	infof("下载完成，正在安装...\n")
 
-	// PHP 版本安装目录 (使用从下载 URL 提取的目录名)
-	versionDir := filepath.Join(phpHome, dirName)
-	fmt.Printf("PHP 版本安装目录: %s\n", versionDir)
+	key, err := installArchive(ctx, version, downloadedFile, record)
+	if err != nil {
+		return err
+	}
 
-	// 如果目录已存在，先询问是否覆盖
-	if _, err := os.Stat(versionDir); err == nil {
-		fmt.Printf("版本 %s 已存在，是否覆盖？(y/n): ", version)
-		var response string
-		fmt.Scanln(&response)
-		if strings.ToLower(response) != "y" {
-			fmt.Println("操作已取消")
-			return
-		}
-		// 删除已存在的目录
-		os.RemoveAll(versionDir)
+	// 自动切换到这个版本
+	return useVersion(ctx, key)
+}
+
+// 下载指定版本，返回压缩包和待登记的安装信息
+func fetchRelease(ctx context.Context, cache *downloadCache, version string) (string, installRecord, error) {
+	downloadedFile, dirName, err := downloadPHP(ctx, cache, version)
+	if err != nil {
+		return "", installRecord{}, withExit(exitCodeOf(err), fmt.Errorf("下载失败: %v", err))
+	}
+	debugf("下载的文件: %s\n", downloadedFile)
+
+	record := installRecord{Dir: dirName, Source: sourceDownload}
+	if b, ok := parseBuildName(dirName); ok {
+		record.Version, record.Flavour, record.Arch, record.Toolchain = b.Version, b.Flavour, b.Arch, b.Toolchain
+	}
+	if record.SHA256, err = fileSHA256(downloadedFile); err != nil {
+		return "", installRecord{}, fmt.Errorf("计算校验和失败: %v", err)
 	}
+	return downloadedFile, record, nil
+}
 
-	fmt.Printf("下载的文件: %s\n", downloadedFile)
+// 从本地压缩包安装（install --from-file）。key 为空时使用压缩包中 PHP 的主次版本号
+func installFromFile(ctx context.Context, key, archive string) error {
+	cleanTempArtifacts(staleTempAge)
 
-	// 检查文件是否存在
-	if _, err := os.Stat(downloadedFile); os.IsNotExist(err) {
-		fmt.Printf("错误: 下载的文件不存在: %s\n", downloadedFile)
-		return
+	archive, err := filepath.Abs(archive)
+	if err != nil {
+		return fmt.Errorf("无效的文件路径: %v", err)
+	}
+	if info, err := os.Stat(archive); err != nil || info.IsDir() {
+		return withExit(exitNotFound, fmt.Errorf("找不到压缩包: %s", archive))
 	}
 
-	// 创建临时解压目录
-	tempExtractDir := filepath.Join(os.TempDir(), "pvm", "extract-"+dirName)
-	os.RemoveAll(tempExtractDir) // 清除之前的目录
-	os.MkdirAll(tempExtractDir, 0755)
+	record := installRecord{Source: sourceFile}
+	if b, ok := parseBuildName(trimArchiveExt(filepath.Base(archive))); ok {
+		record.Dir, record.Version, record.Flavour, record.Arch, record.Toolchain = b.dirName(), b.Version, b.Flavour, b.Arch, b.Toolchain
+	}
+	if record.SHA256, err = fileSHA256(archive); err != nil {
+		return fmt.Errorf("计算校验和失败: %v", err)
+	}
+	infof("正在从 %s 安装...\n", archive)
+	if key, err = installArchive(ctx, key, archive, record); err != nil {
+		return err
+	}
+	return useVersion(ctx, key)
+}
+
+// 从已解压的目录安装（install --from-dir），目录会被复制到 phps 下
+func installFromDir(ctx context.Context, key, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("无效的目录: %v", err)
+	}
+	if !isDir(dir) {
+		return withExit(exitNotFound, fmt.Errorf("找不到目录: %s", dir))
+	}
+
+	b, err := inspectBuild(dir, filepath.Base(dir))
+	if err != nil {
+		return err
+	}
+	record := installRecord{
+		Dir:       b.dirName(),
+		Version:   b.Version,
+		Flavour:   b.Flavour,
+		Arch:      b.Arch,
+		Toolchain: b.Toolchain,
+		Source:    sourceDir,
+	}
+	if key == "" {
+		key = b.series()
+	}
+	infof("正在从 %s 安装 PHP %s...\n", dir, b.Version)
+	if err := installTree(ctx, key, dir, record); err != nil {
+		return err
+	}
+	return useVersion(ctx, key)
+}
+
+// 解压压缩包并安装，返回登记使用的版本名称。record.Dir 为空时根据解压出的 php -v 输出确定构建信息
+func installArchive(ctx context.Context, key, archive string, record installRecord) (string, error) {
+	if err := os.MkdirAll(tempPath(), 0755); err != nil {
+		return "", fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	tempExtractDir, err := os.MkdirTemp(tempPath(), "extract-"+filepath.Base(archive)+"-")
+	if err != nil {
+		return "", fmt.Errorf("创建临时解压目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempExtractDir)
 
 	// 解压 PHP 文件到临时目录
-	if err := extractZip(downloadedFile, tempExtractDir); err != nil {
-		fmt.Printf("安装失败: %v\n", err)
-		return
+	if err := extractArchive(ctx, archive, tempExtractDir); err != nil {
+		return "", fmt.Errorf("安装失败: %v", err)
 	}
 
-	// 检查解压后的目录结构
+	// 如果解压出的是单一目录，则使用该目录的内容
 	extractedItems, _ := filepath.Glob(filepath.Join(tempExtractDir, "*"))
-	fmt.Printf("解压目录内容: %v\n", extractedItems)
+	debugf("解压目录内容: %v\n", extractedItems)
+	srcDir := tempExtractDir
+	if len(extractedItems) == 1 && isDir(extractedItems[0]) {
+		srcDir = extractedItems[0]
+	}
 
-	// 确保目标目录存在
-	os.MkdirAll(versionDir, 0755)
+	if record.Dir == "" {
+		b, err := inspectBuild(srcDir, filepath.Base(srcDir))
+		if err != nil {
+			return "", err
+		}
+		record.Dir, record.Version, record.Flavour, record.Arch, record.Toolchain = b.dirName(), b.Version, b.Flavour, b.Arch, b.Toolchain
+	}
+	if key == "" {
+		key = versionSeries(record.Version)
+	}
+	return key, installTree(ctx, key, srcDir, record)
+}
 
-	// 移动文件到最终目录
-	// 如果解压出的是单一目录，则将其内容移动到版本目录
-	if len(extractedItems) == 1 && isDir(extractedItems[0]) {
-		// 复制单一目录中的所有文件
-		fmt.Printf("移动目录 %s 中的内容到 %s\n", extractedItems[0], versionDir)
-		moveCmd := exec.Command("xcopy", filepath.Join(extractedItems[0], "*"), versionDir, "/E", "/I", "/Y")
-		if output, err := moveCmd.CombinedOutput(); err != nil {
-			fmt.Printf("移动文件失败: %v, 输出: %s\n", err, string(output))
-			return
+// 确定目录中 PHP 的构建信息：优先使用目录名，否则运行其中的 php -v
+func inspectBuild(dir, name string) (phpBuild, error) {
+	if b, ok := parseBuildName(name); ok {
+		return b, nil
+	}
+	output, err := exec.Command(filepath.Join(dir, phpBinary), "-v").Output()
+	if err != nil {
+		return phpBuild{}, fmt.Errorf("无法识别 %s 中的 PHP 版本: %v", dir, err)
+	}
+	b, ok := parsePHPVersionOutput(string(output))
+	if !ok {
+		return phpBuild{}, fmt.Errorf("无法识别 %s 中的 PHP 版本", dir)
+	}
+	if !isWindows {
+		b.Arch, b.Toolchain = hostArch(), ""
+		return b, nil
+	}
+	// 5.x 和 7.0 的 php -v 不显示架构和编译器，从 php.exe 的文件头读取
+	if arch, toolchain, err := inspectExecutable(filepath.Join(dir, "php.exe")); err == nil {
+		b.Arch = arch
+		if b.Toolchain == "" {
+			b.Toolchain = toolchain
 		}
 	} else {
-		// 否则直接移动所有文件
-		fmt.Printf("移动 %s 中的内容到 %s\n", tempExtractDir, versionDir)
-		moveCmd := exec.Command("xcopy", filepath.Join(tempExtractDir, "*"), versionDir, "/E", "/I", "/Y")
-		if output, err := moveCmd.CombinedOutput(); err != nil {
-			fmt.Printf("移动文件失败: %v, 输出: %s\n", err, string(output))
-			return
+		debugf("读取 php.exe 文件头失败: %v\n", err)
+	}
+	if b.Toolchain == "" {
+		return phpBuild{}, fmt.Errorf("无法识别 %s 中 PHP 的编译器版本", dir)
+	}
+	return b, nil
+}
+
+// 把 srcDir 的内容复制到 phps/<record.Dir>，创建 php.ini 并登记到清单。
+// 先复制到临时目录，全部完成后再替换，失败或中断时保留原来的安装
+func installTree(ctx context.Context, key, srcDir string, record installRecord) error {
+	// 获取 PHP 安装目录
+	phpHome, err := getPHPHome()
+	if err != nil {
+		return err
+	}
+
+	// 从本地文件或目录安装时，到这里才知道版本
+	if record.Version != "" {
+		if err := checkLifecycle(versionSeries(record.Version)); err != nil {
+			return err
 		}
 	}
 
-	// 列出版本目录内容
-	files, _ := filepath.Glob(filepath.Join(versionDir, "*"))
-	fmt.Printf("版本目录内容: %v\n", files)
+	// PHP 版本安装目录
+	versionDir := filepath.Join(phpHome, record.Dir)
+	debugf("PHP 版本安装目录: %s\n", versionDir)
+
+	// 如果目录已存在，先询问是否覆盖
+	if _, err := os.Stat(versionDir); err == nil {
+		if !confirm(fmt.Sprintf("版本 %s 已存在，是否覆盖？", key)) {
+			return errCanceled
+		}
+		if err := ensureNotBusy(ctx, versionDir); err != nil {
+			return err
+		}
+	}
 
-	// 创建 php.ini 文件（从 php.ini-development 复制）
-	iniDev := filepath.Join(versionDir, "php.ini-development")
-	iniFile := filepath.Join(versionDir, "php.ini")
-	if _, err := os.Stat(iniDev); err == nil {
-		fmt.Printf("复制 %s 到 %s\n", iniDev, iniFile)
+	// 复制文件到临时目录
+	staging, err := os.MkdirTemp(phpHome, ".staging-"+record.Dir+"-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(staging)
+	debugf("复制 %s 中的内容到 %s\n", srcDir, staging)
+	if err := copyDirectory(ctx, srcDir, staging); err != nil {
+		return interrupted(ctx, fmt.Errorf("复制文件失败: %v", err))
+	}
+	os.Chmod(staging, 0755)
+
+	// 创建 php.ini 文件（从 php.ini-development 复制），已有 php.ini 时保留
+	iniDev := filepath.Join(staging, "php.ini-development")
+	iniFile := filepath.Join(staging, "php.ini")
+	if _, err := os.Stat(iniFile); err == nil {
+		debugf("保留已有的 php.ini\n")
+	} else if _, err := os.Stat(iniDev); err == nil {
+		debugf("复制 %s 到 %s\n", iniDev, iniFile)
 		// 使用文件操作而不是命令
 		iniData, err := os.ReadFile(iniDev)
 		if err == nil {
 			os.WriteFile(iniFile, iniData, 0644)
 		} else {
-			fmt.Printf("复制 php.ini 失败: %v\n", err)
+			warnf("复制 php.ini 失败: %v\n", err)
 		}
-	} else {
-		fmt.Printf("找不到 php.ini-development: %v\n", err)
+	} else if isWindows {
+		warnf("找不到 php.ini-development: %v\n", err)
 	}
 
-	// 保存版本信息
-	saveVersionInfo(version, dirName)
+	// 其他平台上 php 统一放在 bin 子目录中，PATH 中只需要加入 php_home/bin
+	if !isWindows && isFile(filepath.Join(staging, phpBinary)) && !isFile(filepath.Join(staging, "bin", phpBinary)) {
+		if err := os.MkdirAll(filepath.Join(staging, "bin"), 0755); err != nil {
+			return fmt.Errorf("创建 bin 目录失败: %v", err)
+		}
+		if err := os.Rename(filepath.Join(staging, phpBinary), filepath.Join(staging, "bin", phpBinary)); err != nil {
+			return fmt.Errorf("移动 %s 失败: %v", phpBinary, err)
+		}
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
 
-	fmt.Printf("PHP %s 安装完成\n", version)
+	// 替换版本目录
+	swap, err := replaceDir(ctx, staging, versionDir)
+	if err != nil {
+		return err
+	}
 
-	// 自动切换到这个版本
-	useVersion(version)
+	// 列出版本目录内容
+	files, _ := filepath.Glob(filepath.Join(versionDir, "*"))
+	debugf("版本目录内容: %v\n", files)
+
+	// 保存版本信息，失败时恢复原来的目录
+	record.Installed = time.Now()
+	if err := saveVersionInfo(key, record); err != nil {
+		swap.rollback()
+		return err
+	}
+	swap.commit()
+
+	infof("PHP %s 安装完成\n", key)
+	return nil
 }
 
 // 检查路径是否是目录
@@ -671,44 +773,73 @@ func isDir(path string) bool {
 	return info.IsDir()
 }
 
-func saveVersionInfo(version, dirName string) error {
-	// 获取 PHP 安装目录
-	phpHome, err := getPHPHome()
+// 检查路径是否是普通文件
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func saveVersionInfo(version string, record installRecord) error {
+	m, err := loadManifest()
 	if err != nil {
 		return err
 	}
 
-	// 版本映射文件
-	versionFile := filepath.Join(phpHome, "versions.json")
+	// 添加或更新版本映射
+	m[version] = record
+	if err := m.save(); err != nil {
+		return err
+	}
+	appendHistory(historyEntry{Action: actionInstall, To: version, Version: record.Version, Source: record.Source})
 
-	// 读取现有版本映射
-	var versionMap map[string]string
-	data, err := os.ReadFile(versionFile)
-	if err == nil {
-		// 文件存在，解析 JSON
-		if err := json.Unmarshal(data, &versionMap); err != nil {
-			versionMap = make(map[string]string)
-		}
-	} else {
-		// 文件不存在，创建新映射
-		versionMap = make(map[string]string)
+	debugf("版本信息已保存\n")
+	return nil
+}
+
+// 保护 remote-versions.json，多个版本同时安装时会并发记录
+var remoteVersionsMu sync.Mutex
+
+// 记录官网目录页中出现的完整版本号，供补全脚本使用
+func recordRemoteVersions(listing []byte) {
+	remoteVersionsMu.Lock()
+	defer remoteVersionsMu.Unlock()
+	reVersion := regexp.MustCompile(`php-(\d+\.\d+\.\d+)-`)
+	versions := make(map[string]bool)
+	for _, v := range loadRemoteVersions() {
+		versions[v] = true
+	}
+	for _, match := range reVersion.FindAllSubmatch(listing, -1) {
+		versions[string(match[1])] = true
 	}
 
-	// 添加或更新版本映射
-	versionMap[version] = dirName
+	list := make([]string, 0, len(versions))
+	for v := range versions {
+		list = append(list, v)
+	}
+	sort.Strings(list)
 
-	// 保存回文件
-	data, err = json.MarshalIndent(versionMap, "", "  ")
+	data, err := json.MarshalIndent(list, "", "  ")
 	if err != nil {
-		return fmt.Errorf("保存版本信息失败: %v", err)
+		return
 	}
-
-	if err := os.WriteFile(versionFile, data, 0644); err != nil {
-		return fmt.Errorf("写入版本文件失败: %v", err)
+	if err := os.MkdirAll(cachePath(), 0755); err != nil {
+		debugf("创建缓存目录失败: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cachePath(), "remote-versions.json"), data, 0644); err != nil {
+		debugf("保存远程版本列表失败: %v\n", err)
 	}
+}
 
-	fmt.Printf("版本信息已保存\n")
-	return nil
+// 读取上次记录的远程版本列表
+func loadRemoteVersions() []string {
+	var list []string
+	data, err := os.ReadFile(filepath.Join(cachePath(), "remote-versions.json"))
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(data, &list)
+	return list
 }
 
 func getVersionDir(version string) (string, error) {
@@ -718,22 +849,13 @@ func getVersionDir(version string) (string, error) {
 		return "", err
 	}
 
-	// 版本映射文件
-	versionFile := filepath.Join(phpHome, "versions.json")
-
-	// 读取版本映射
-	var versionMap map[string]string
-	data, err := os.ReadFile(versionFile)
-	if err == nil {
-		// 文件存在，解析 JSON
-		if err := json.Unmarshal(data, &versionMap); err != nil {
-			return "", fmt.Errorf("解析版本映射失败: %v", err)
-		}
-
-		// 查找版本
-		if dirName, ok := versionMap[version]; ok {
-			return filepath.Join(phpHome, dirName), nil
-		}
+	// 查找版本清单
+	m, err := loadManifest()
+	if err != nil {
+		return "", err
+	}
+	if r, ok := m[version]; ok {
+		return filepath.Join(phpHome, r.Dir), nil
 	}
 
 	// 版本不在映射中，尝试直接匹配目录
@@ -744,133 +866,141 @@ func getVersionDir(version string) (string, error) {
 		return matches[0], nil
 	}
 
-	return "", fmt.Errorf("找不到版本 %s 的安装目录", version)
+	return "", withExit(exitNotFound, fmt.Errorf("找不到版本 %s 的安装目录", version))
 }
 
-func useVersion(version string) {
+func useVersion(ctx context.Context, version string) error {
+	version = normalizeVersion(version)
+	cleanTempArtifacts(staleTempAge)
+
 	// 获取版本目录
 	versionDir, err := getVersionDir(version)
 	if err != nil {
-		fmt.Printf("版本 %s 不存在，是否要安装？(y/n): ", version)
-		var response string
-		fmt.Scanln(&response)
-		if strings.ToLower(response) == "y" {
-			installVersion(version)
-			return
+		if !confirm(fmt.Sprintf("版本 %s 不存在，是否要安装？", version)) {
+			return err
 		}
-		fmt.Println("操作已取消")
-		return
+		return installVersion(ctx, version)
 	}
 
-	fmt.Printf("找到 PHP 目录: %s\n", versionDir)
+	debugf("找到 PHP 目录: %s\n", versionDir)
+	previous, previousDir := currentKey(), currentDir()
 
-	// 验证 php.exe 是否存在
-	phpExe := filepath.Join(versionDir, "php.exe")
-	if _, err := os.Stat(phpExe); os.IsNotExist(err) {
-		fmt.Printf("警告: php.exe 不存在于 %s，安装可能不完整\n", versionDir)
-		fmt.Printf("是否重新安装 PHP %s? (y/n): ", version)
-		var response string
-		fmt.Scanln(&response)
-		if strings.ToLower(response) == "y" {
-			installVersion(version)
-			return
-		}
+	series := versionSeries(version)
+	if b, ok := parseBuildName(filepath.Base(versionDir)); ok {
+		series = b.series()
+	}
+	if err := checkLifecycle(series); err != nil {
+		return err
 	}
 
-	// PHP_HOME 目录路径
-	phpHomeDir := "D:\\app\\pvm\\php_home"
-
-	// 清理现有的PHP_HOME目录
-	fmt.Printf("清理目录: %s\n", phpHomeDir)
-	if err := os.RemoveAll(phpHomeDir); err != nil {
-		fmt.Printf("警告: 无法删除旧目录: %v，尝试清空目录内容\n", err)
-
-		// 尝试清空目录内容
-		if err := removeContents(phpHomeDir); err != nil {
-			fmt.Printf("警告: 无法清空目录内容: %v\n", err)
+	// 验证 php 可执行文件是否存在，不完整的安装不切换
+	if !hasPHPBinary(versionDir) {
+		warnf("%s 不存在于 %s，安装可能不完整\n", phpBinary, versionDir)
+		if confirm(fmt.Sprintf("是否重新安装 PHP %s?", version)) {
+			return installVersion(ctx, version)
 		}
+		return fmt.Errorf("没有切换到 %s，请运行 pvm install %s 重新安装", version, version)
 	}
 
-	// 等待1秒，确保文件系统操作完成
-	time.Sleep(1 * time.Second)
+	// Windows 上 php_home 是复制的目录，其中的程序正在运行时无法替换
+	if isWindows {
+		if err := ensureNotBusy(ctx, phpHomePath()); err != nil {
+			return err
+		}
+	}
 
-	// 创建新的空目录
-	fmt.Printf("创建新目录: %s\n", phpHomeDir)
-	if err := os.MkdirAll(phpHomeDir, 0755); err != nil {
-		fmt.Printf("创建目录失败: %v，尝试使用其他方法\n", err)
-		return
+	if err := activateVersion(ctx, version, versionDir); err != nil {
+		return err
 	}
 
-	// 使用手动文件复制方法而不是xcopy
-	fmt.Printf("正在将PHP文件从 %s 复制到 %s\n", versionDir, phpHomeDir)
+	// 运行新版本的 php 检查切换结果，失败时恢复原来的版本
+	_, want := currentSelection(versionDir)
+	if err := verifySwitch(ctx, want); err != nil {
+		warnf("切换后检查失败: %v\n", err)
+		if rbErr := rollbackSwitch(ctx, previous, previousDir); rbErr != nil {
+			return fmt.Errorf("PHP %s 无法正常运行，恢复原来的版本也失败了: %v", version, rbErr)
+		}
+		return fmt.Errorf("PHP %s 无法正常运行，已恢复到切换前的状态", version)
+	}
+	appendHistory(historyEntry{Action: actionUse, From: previous, To: version, Source: switchSource})
+	infof("已成功切换到版本 %s\n", version)
+	return nil
+}
 
-	// 枚举源目录中的所有文件
-	err = copyDirectory(versionDir, phpHomeDir)
+// 卸载已安装的版本：删除版本目录和清单中指向它的名称。正在使用的版本需要先切换或 deactivate
+func uninstallVersion(ctx context.Context, version string) error {
+	version = normalizeVersion(version)
+	versionDir, err := uninstallDir(version)
 	if err != nil {
-		fmt.Printf("复制文件失败: %v\n", err)
-		fmt.Println("尝试使用robocopy命令...")
-
-		// 如果Go的文件复制方法失败，尝试使用robocopy命令
-		robocopyCmd := exec.Command("robocopy", versionDir, phpHomeDir, "/E", "/NFL", "/NDL")
-		output, err := robocopyCmd.CombinedOutput()
-		if err != nil {
-			// robocopy的返回码不是标准的0=成功，需要特殊处理
-			exitCode := robocopyCmd.ProcessState.ExitCode()
-			if exitCode >= 8 {
-				fmt.Printf("robocopy失败，返回码: %d, 输出: %s\n", exitCode, string(output))
-
-				// 最后尝试使用批处理文件进行复制
-				fmt.Println("尝试使用批处理文件进行复制...")
-				copyBat := filepath.Join(os.TempDir(), "pvm_copy.bat")
-				copyContent := fmt.Sprintf(`@echo off
-echo 正在复制PHP文件...
-md "%s" 2>nul
-xcopy "%s\*.*" "%s\" /E /I /Y
-if errorlevel 1 (
-  echo 复制失败
-  exit /b 1
-)
-echo 复制成功
-`, phpHomeDir, versionDir, phpHomeDir)
-
-				if err := os.WriteFile(copyBat, []byte(copyContent), 0644); err != nil {
-					fmt.Printf("创建复制批处理文件失败: %v\n", err)
-					return
-				}
+		return err
+	}
+	if cur := currentDir(); cur != "" && samePath(cur, versionDir) {
+		return fmt.Errorf("版本 %s 正在使用，请先切换到其他版本或运行 pvm deactivate", version)
+	}
+	if err := ensureNotBusy(ctx, versionDir); err != nil {
+		return err
+	}
 
-				copyCmd := exec.Command("cmd", "/C", copyBat)
-				output, err = copyCmd.CombinedOutput()
-				if err != nil {
-					fmt.Printf("批处理复制失败: %v, 输出: %s\n", err, string(output))
-					return
-				}
-			}
+	m, err := loadManifest()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(versionDir); err != nil {
+		return fmt.Errorf("删除 %s 失败: %v", versionDir, err)
+	}
+	dirName := filepath.Base(versionDir)
+	fullVersion := ""
+	for key, r := range m {
+		if r.Dir == dirName {
+			fullVersion = r.Version
+			delete(m, key)
 		}
 	}
+	if err := m.save(); err != nil {
+		return err
+	}
+	appendHistory(historyEntry{Action: actionUninstall, To: version, Version: fullVersion})
+	infof("已卸载 PHP %s\n", version)
+	return nil
+}
 
-	fmt.Println("文件复制成功")
-
-	// 创建一个批处理文件，用于在需要时刷新环境变量
-	refreshBat := filepath.Join(phpHomeDir, "refresh_env.bat")
-	refreshContent := fmt.Sprintf(`@echo off
-echo 当前PHP版本: %s
-php -v
-`, version)
-	if err := os.WriteFile(refreshBat, []byte(refreshContent), 0644); err != nil {
-		fmt.Printf("警告: 创建刷新脚本失败: %v\n", err)
+// 要卸载的版本目录。只接受清单中的版本或 phps 中的目录名，不像 use 那样按前缀匹配，
+// 避免 pvm uninstall 8.1 删除碰巧排在最前面的 8.1.x；有相近的版本时列出它们
+func uninstallDir(version string) (string, error) {
+	m, err := loadManifest()
+	if err != nil {
+		return "", err
+	}
+	if r, ok := m[version]; ok {
+		return filepath.Join(phpsPath(), r.Dir), nil
+	}
+	if filepath.Base(version) == version && !strings.HasPrefix(version, ".") {
+		if dir := filepath.Join(phpsPath(), version); isDir(dir) {
+			return dir, nil
+		}
 	}
 
-	// 更新 PATH 环境变量（只添加php_home目录）
-	if err := updatePATH(versionDir); err != nil {
-		fmt.Printf("警告: %v\n", err)
-	} else {
-		fmt.Printf("已成功切换到版本 %s\n", version)
-		fmt.Printf("环境变量已设置，当前会话和未来会话都将使用 PHP %s\n", version)
+	var similar []string
+	for key := range m {
+		if strings.HasPrefix(key, version) {
+			similar = append(similar, key)
+		}
+	}
+	entries, _ := os.ReadDir(phpsPath())
+	for _, e := range entries {
+		if _, found := m.findDir(e.Name()); e.IsDir() && !found && strings.HasPrefix(e.Name(), "php-"+version) {
+			similar = append(similar, e.Name())
+		}
 	}
+	if len(similar) > 0 {
+		sort.Strings(similar)
+		return "", withExit(exitNotFound, fmt.Errorf("没有安装版本 %s，请指定要卸载的完整版本:\n  %s", version, strings.Join(similar, "\n  ")))
+	}
+	return "", withExit(exitNotFound, fmt.Errorf("找不到版本 %s 的安装目录", version))
 }
 
 // 使用Go原生函数复制目录
-func copyDirectory(src, dst string) error {
+func copyDirectory(ctx context.Context, src, dst string) error {
 	// 获取源目录信息
 	srcInfo, err := os.Stat(src)
 	if err != nil {
@@ -890,19 +1020,22 @@ func copyDirectory(src, dst string) error {
 
 	// 复制每个文件或子目录
 	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
 			// 递归复制子目录
-			if err = copyDirectory(srcPath, dstPath); err != nil {
-				fmt.Printf("复制目录 %s 失败: %v\n", srcPath, err)
+			if err = copyDirectory(ctx, srcPath, dstPath); err != nil {
+				debugf("复制目录 %s 失败: %v\n", srcPath, err)
 				return err
 			}
 		} else {
 			// 复制文件
-			if err = copyFile(srcPath, dstPath); err != nil {
-				fmt.Printf("复制文件 %s 失败: %v\n", srcPath, err)
+			if err = copyFile(ctx, srcPath, dstPath); err != nil {
+				debugf("复制文件 %s 失败: %v\n", srcPath, err)
 				return err
 			}
 		}
@@ -912,7 +1045,7 @@ func copyDirectory(src, dst string) error {
 }
 
 // 复制单个文件
-func copyFile(src, dst string) error {
+func copyFile(ctx context.Context, src, dst string) error {
 	// 打开源文件
 	in, err := os.Open(src)
 	if err != nil {
@@ -928,7 +1061,7 @@ func copyFile(src, dst string) error {
 	defer out.Close()
 
 	// 复制内容
-	_, err = io.Copy(out, in)
+	_, err = io.Copy(out, &ctxReader{ctx: ctx, r: in})
 	if err != nil {
 		return err
 	}
@@ -971,83 +1104,51 @@ func removeContents(dir string) error {
 	return nil
 }
 
-func getCurrentVersion() string {
-	path := os.Getenv("PATH")
-	paths := strings.Split(path, ";")
-
-	for _, p := range paths {
-		// 检查路径是否包含 php 目录
-		if strings.Contains(strings.ToLower(p), "php") {
-			// 检查 php.exe 是否存在
-			phpExe := filepath.Join(p, "php.exe")
-			if _, err := os.Stat(phpExe); err == nil {
-				return p
-			}
-		}
-	}
-
-	return ""
-}
-
 // 检查PHP官网上可用的版本
-func checkAvailableVersions() {
-	fmt.Println("正在查询PHP可用版本信息...")
+func checkAvailableVersions(ctx context.Context) error {
+	infof("正在查询PHP可用版本信息...\n")
 
-	// 获取最新版本目录
-	resp, err := http.Get(phpNewURL)
+	// 获取发布目录和归档目录中的所有版本
+	builds, err := remoteBuilds(ctx)
 	if err != nil {
-		fmt.Printf("获取版本列表失败: %v\n", err)
-		return
+		return err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("读取版本列表失败: %v\n", err)
-		return
+	if len(builds) == 0 {
+		return withExit(exitNotFound, errors.New("未找到可用的PHP版本信息\n请访问 https://windows.php.net/download 查看可用的PHP版本"))
 	}
 
-	// 查找所有版本号
-	reVersion := regexp.MustCompile(`php-(\d+\.\d+\.\d+)-`)
-	matches := reVersion.FindAllStringSubmatch(string(body), -1)
-
-	if len(matches) == 0 {
-		fmt.Println("未找到可用的PHP版本信息")
-		fmt.Println("请访问 https://windows.php.net/download 查看可用的PHP版本")
-		return
+	// 按主次版本号分类，构建已按版本号排序
+	var series []string
+	majorVersions := make(map[string][]string)
+	for _, b := range builds {
+		majorVersion := b.series()
+		list := majorVersions[majorVersion]
+		if len(list) == 0 {
+			series = append(series, majorVersion)
+		}
+		if len(list) == 0 || list[len(list)-1] != b.Version {
+			majorVersions[majorVersion] = append(list, b.Version)
+		}
 	}
 
-	// 用于去重的map
-	versions := make(map[string]bool)
-	for _, match := range matches {
-		if len(match) > 1 {
-			versions[match[1]] = true
-		}
+	if jsonOutput {
+		return printJSON(majorVersions)
 	}
 
 	// 输出所有可用版本
-	fmt.Println("在PHP官网上找到以下可用版本:")
+	infof("在PHP官网上找到以下可用版本:\n")
 
-	// 按主版本号分类
-	majorVersions := make(map[string][]string)
-	for version := range versions {
-		parts := strings.Split(version, ".")
-		if len(parts) >= 2 {
-			majorVersion := parts[0] + "." + parts[1]
-			majorVersions[majorVersion] = append(majorVersions[majorVersion], version)
+	// 按主次版本号排序输出
+	for _, majorVersion := range series {
+		infof("PHP %s 系列:\n", majorVersion)
+		for _, version := range majorVersions[majorVersion] {
+			infof("  - %s\n", version)
 		}
+		infof("\n")
 	}
 
-	// 按主版本号排序输出
-	for majorVersion, subVersions := range majorVersions {
-		fmt.Printf("PHP %s 系列:\n", majorVersion)
-		for _, version := range subVersions {
-			fmt.Printf("  - %s\n", version)
-		}
-		fmt.Println()
-	}
-
-	fmt.Println("提示: 安装时可以使用简化版本号，例如:")
-	fmt.Println("  pvm install 8.2 - 会安装8.2系列的最新版本")
-	fmt.Println("  pvm install 8.2.0 - 会精确安装8.2.0版本")
+	infof("提示: 安装时可以使用简化版本号，例如:\n")
+	infof("  pvm install 8.2 - 会安装8.2系列的最新版本\n")
+	infof("  pvm install 8.2.0 - 会精确安装8.2.0版本\n")
+	return nil
 }
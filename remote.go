@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 目录页中的压缩包文件名
+var buildFilePattern = regexp.MustCompile(`php-\d+\.\d+[^"'<>\s/]*?\.(?:zip|tar\.gz)`)
+
+// 从目录页中解析出所有构建，忽略调试包、开发包和源码包
+func parseIndexBuilds(listing []byte) []phpBuild {
+	var builds []phpBuild
+	for _, name := range buildFilePattern.FindAllString(string(listing), -1) {
+		if b, ok := parseBuildName(name); ok {
+			builds = append(builds, b)
+		}
+	}
+	return builds
+}
+
+// 读取归档目录和发布目录，返回按版本排序、去重后的所有构建
+func remoteBuilds(ctx context.Context) ([]phpBuild, error) {
+	if !isWindows {
+		builds, err := staticBuilds(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sortBuilds(builds)
+		return builds, nil
+	}
+	archived, _, archivedErr := fetchIndexPage(ctx, archivesDir)
+	if ctx.Err() != nil {
+		return nil, errInterrupted
+	}
+	current, _, currentErr := fetchIndexPage(ctx, "")
+	if ctx.Err() != nil {
+		return nil, errInterrupted
+	}
+	if archivedErr != nil && currentErr != nil {
+		return nil, withExit(exitCodeOf(currentErr), fmt.Errorf("获取版本列表失败: %v", currentErr))
+	}
+	listing := append(append([]byte{}, archived...), current...)
+	recordRemoteVersions(listing)
+
+	seen := make(map[string]bool)
+	var builds []phpBuild
+	for _, b := range parseIndexBuilds(listing) {
+		key := strings.ToLower(b.File)
+		if !seen[key] {
+			seen[key] = true
+			builds = append(builds, b)
+		}
+	}
+	sortBuilds(builds)
+	return builds, nil
+}
+
+// 按版本号从低到高排序，同一版本按文件名排序
+func sortBuilds(builds []phpBuild) {
+	sort.SliceStable(builds, func(i, j int) bool {
+		if cmp := compareVersions(builds[i].Version, builds[j].Version); cmp != 0 {
+			return cmp < 0
+		}
+		return builds[i].File < builds[j].File
+	})
+}
+
+// 已安装的构建目录名（小写），包括清单中的和 phps 下未登记的目录
+func installedDirs() map[string]bool {
+	dirs := make(map[string]bool)
+	if m, err := loadManifest(); err == nil {
+		for _, r := range m {
+			dirs[strings.ToLower(r.Dir)] = true
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(phpsPath(), "php-*"))
+	for _, dir := range matches {
+		if isDir(dir) {
+			dirs[strings.ToLower(filepath.Base(dir))] = true
+		}
+	}
+	return dirs
+}
+
+// ls-remote 输出中的一个版本
+type remoteVersion struct {
+	Version   string     `json:"version"`
+	Installed bool       `json:"installed"`
+	Support   string     `json:"support"`
+	Builds    []phpBuild `json:"builds"`
+}
+
+// 构建的筛选条件，空字符串表示不限
+type buildFilter struct {
+	flavour, arch, toolchain string
+}
+
+func (f buildFilter) validate() error {
+	switch f.flavour {
+	case "", "ts", "nts":
+	default:
+		return usageErrorf("无效的 --flavour: %s，可选 ts 或 nts", f.flavour)
+	}
+	switch f.arch {
+	case "", "x64", "x86", "arm64":
+	default:
+		return usageErrorf("无效的 --arch: %s，可选 x64、x86 或 arm64", f.arch)
+	}
+	return nil
+}
+
+func (f buildFilter) matches(b phpBuild) bool {
+	return (f.flavour == "" || b.Flavour == f.flavour) &&
+		(f.arch == "" || b.Arch == f.arch) &&
+		(f.toolchain == "" || b.Toolchain == f.toolchain)
+}
+
+// 列出官网上的版本
+func listRemoteVersions(ctx context.Context, constraint string, filter buildFilter, latestPerMinor bool) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	var c versionConstraint
+	if constraint != "" {
+		var err error
+		if c, err = parseConstraint(constraint); err != nil {
+			return withExit(exitUsage, err)
+		}
+	}
+
+	builds, err := remoteBuilds(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 使用 --pre 或约束中给出了预发布版本时，加上预发布目录和快照目录中的构建
+	pre := includePrerelease || c.allowsPrerelease()
+	if pre {
+		extra, err := prereleaseBuilds(ctx)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		for _, b := range extra {
+			builds = append(builds, b.phpBuild)
+		}
+		sortBuilds(builds)
+	}
+
+	// 按版本分组，保持升序
+	installed := installedDirs()
+	var versions []*remoteVersion
+	for _, b := range builds {
+		if c != nil && !c.matches(b.Version) || !filter.matches(b) || isPrerelease(b.Version) && !pre {
+			continue
+		}
+		if len(versions) == 0 || versions[len(versions)-1].Version != b.Version {
+			status, _ := supportStatus(b.series(), time.Now())
+			versions = append(versions, &remoteVersion{Version: b.Version, Support: status})
+		}
+		v := versions[len(versions)-1]
+		v.Builds = append(v.Builds, b)
+		if installed[strings.ToLower(b.dirName())] {
+			v.Installed = true
+		}
+	}
+
+	// 每个主次版本只保留最新的补丁版本
+	if latestPerMinor {
+		var latest []*remoteVersion
+		for i, v := range versions {
+			if i+1 == len(versions) || versionSeries(versions[i+1].Version) != versionSeries(v.Version) {
+				latest = append(latest, v)
+			}
+		}
+		versions = latest
+	}
+
+	if len(versions) == 0 {
+		return withExit(exitNotFound, errors.New("没有符合条件的版本"))
+	}
+
+	if jsonOutput {
+		return printJSON(versions)
+	}
+	for _, v := range versions {
+		var flavours, arches, toolchains []string
+		for _, b := range v.Builds {
+			flavours = appendUnique(flavours, b.Flavour)
+			arches = appendUnique(arches, b.Arch)
+			toolchains = appendUnique(toolchains, b.Toolchain)
+		}
+		mark := ""
+		if v.Support == supportEOL {
+			mark = "  " + supportNames[supportEOL]
+		}
+		if v.Installed {
+			mark += "  (已安装)"
+		}
+		line := fmt.Sprintf("  %-10s %-7s %-8s %-10s%s", v.Version, strings.Join(flavours, ","), strings.Join(arches, ","), strings.Join(toolchains, ","), mark)
+		infof("%s\n", strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// 追加不重复的元素
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func newLsRemoteCommand() *command {
+	var filter buildFilter
+	var latestPerMinor bool
+	return &command{
+		name:    "ls-remote",
+		args:    "[版本约束]",
+		summary: "列出官网上可以安装的版本",
+		description: `
+列出官网发布目录和归档目录中的所有版本，按版本号从低到高排序，已安装的版本会被标出。
+版本约束可以是 8、8.2、8.2.15 等前缀，也可以使用 >=、>、<=、<、= 比较，
+多个条件用逗号分隔，例如 pvm ls-remote ">=8.1,<8.3"；^8.2 表示 8.2 到 9 之前，
+~8.2.3 表示 8.2.3 到 8.3 之前。
+预发布版本（alpha、beta、RC）和快照只在使用 --pre 或约束中给出预发布版本
+（例如 ">=8.4.0RC1"）时列出。
+
+目录页缓存在 <根目录>/cache/index 中，有效期内（默认 1 小时，可通过 index_ttl 设置）
+不会访问网络，过期后通过 ETag/If-Modified-Since 重新验证。`,
+		completeArg: func(args []string) []string {
+			if len(args) > 0 {
+				return nil
+			}
+			return completeRemoteVersions(nil)
+		},
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&filter.flavour, "flavour", "", "只列出指定线程安全类型的构建: ts 或 nts")
+			fs.StringVar(&filter.arch, "arch", "", "只列出指定架构的构建: x64、x86 或 arm64")
+			fs.StringVar(&filter.toolchain, "toolchain", "", "只列出指定编译器的构建，例如 vs16 或 vc11")
+			fs.BoolVar(&latestPerMinor, "latest-per-minor", false, "每个主次版本只列出最新的补丁版本")
+			fs.BoolVar(&refreshIndex, "refresh", false, "忽略缓存有效期，重新验证目录页")
+			fs.BoolVar(&includePrerelease, "pre", false, "同时列出预发布目录（qa_url）和快照目录（snapshot_url）中的版本")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 1, "最多只能指定一个版本约束，多个条件请用逗号分隔"); err != nil {
+				return err
+			}
+			constraint := ""
+			if len(args) == 1 {
+				constraint = args[0]
+			}
+			filter.flavour = strings.ToLower(filter.flavour)
+			filter.arch = strings.ToLower(filter.arch)
+			filter.toolchain = strings.ToLower(filter.toolchain)
+			return listRemoteVersions(commandCtx, constraint, filter, latestPerMinor)
+		},
+	}
+}
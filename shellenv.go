@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 需要加入 PATH 的目录：从源码编译的版本中 php 位于 bin 子目录
+func phpBinDir() string {
+	bin := filepath.Join(phpHomePath(), "bin")
+	if _, err := os.Stat(filepath.Join(bin, phpBinary)); err == nil {
+		return bin
+	}
+	return phpHomePath()
+}
+
+// 比较 PATH 中的目录，Windows 上不区分大小写
+func samePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if isWindows {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// 展开 PATH 条目中引用的环境变量：Windows 上为 %VAR%，其他平台为 $VAR
+func expandEnvRefs(s string) string {
+	if !isWindows {
+		return os.ExpandEnv(s)
+	}
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if v, ok := os.LookupEnv(ref[1 : len(ref)-1]); ok {
+			return v
+		}
+		return ref
+	})
+}
+
+var envRefPattern = regexp.MustCompile(`%[^%;]+%`)
+
+// PATH 中是否包含某个目录
+func pathContains(pathList, dir string) bool {
+	for _, p := range filepath.SplitList(pathList) {
+		if p != "" && samePath(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// 把目录放到 PATH 的最前面，并去掉其他位置上的同一目录
+func prependPath(pathList, dir string) string {
+	parts := []string{dir}
+	for _, p := range filepath.SplitList(pathList) {
+		if p != "" && !samePath(p, dir) {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, string(os.PathListSeparator))
+}
+
+// 支持的 shell
+var envShells = []string{"bash", "zsh", "sh", "fish", "powershell", "cmd"}
+
+// 当前平台的默认 shell：Windows 上为 PowerShell，其他平台取 SHELL 环境变量
+func defaultShell() string {
+	if isWindows {
+		return "powershell"
+	}
+	name := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range envShells {
+		if s == name {
+			return s
+		}
+	}
+	return "sh"
+}
+
+// 生成设置当前 shell 中 PATH 的命令，在已有 PATH 的基础上计算，重复执行不会重复添加
+func envScript(shell string) (string, error) {
+	newPath := prependPath(os.Getenv("PATH"), phpBinDir())
+	switch shell {
+	case "bash", "zsh", "sh":
+		return fmt.Sprintf("export PATH='%s'\n", strings.ReplaceAll(newPath, "'", `'\''`)), nil
+	case "fish":
+		var quoted []string
+		for _, p := range filepath.SplitList(newPath) {
+			quoted = append(quoted, "'"+strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(p)+"'")
+		}
+		return fmt.Sprintf("set -gx PATH %s\n", strings.Join(quoted, " ")), nil
+	case "powershell":
+		return fmt.Sprintf("$env:PATH = '%s'\n", strings.ReplaceAll(newPath, "'", "''")), nil
+	case "cmd":
+		return fmt.Sprintf("set \"PATH=%s\"\n", newPath), nil
+	}
+	return "", usageErrorf("不支持的 shell: %s，可选 %s", shell, strings.Join(envShells, "、"))
+}
+
+func newEnvCommand() *command {
+	var shell string
+	return &command{
+		name:    "env",
+		summary: "输出在当前 shell 中使用 pvm 管理的 PHP 的命令",
+		description: `
+输出把 php_home 放到 PATH 最前面的命令，供 shell 执行，例如：
+  bash/zsh: eval "$(pvm env)"
+  fish:     pvm env --shell fish | source
+  PowerShell: pvm env --shell powershell | Invoke-Expression
+把上面的命令加入 shell 的配置文件后，每个新终端都会使用 pvm use 切换的版本。`,
+		setup: func(fs *flag.FlagSet) {
+			fs.StringVar(&shell, "shell", "", "目标 shell: "+strings.Join(envShells, "、")+"，默认根据当前环境判断")
+		},
+		run: func(args []string) error {
+			if err := requireArgs(args, 0, 0, "env 命令不接受参数"); err != nil {
+				return err
+			}
+			if shell == "" {
+				shell = defaultShell()
+			}
+			script, err := envScript(strings.ToLower(shell))
+			if err != nil {
+				return err
+			}
+			fmt.Print(script)
+			return nil
+		},
+	}
+}
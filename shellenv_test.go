@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPrependPath(t *testing.T) {
+	a, b, c := filepath.FromSlash("/opt/a"), filepath.FromSlash("/opt/b"), filepath.FromSlash("/opt/c")
+	tests := []struct {
+		name, list, dir, want string
+	}{
+		{"empty", "", a, a},
+		{"new dir", joinPath(b, c), a, joinPath(a, b, c)},
+		{"moves existing", joinPath(b, a, c), a, joinPath(a, b, c)},
+		{"drops empty entries", joinPath(b, "", c, ""), a, joinPath(a, b, c)},
+		{"trailing separator", joinPath(b, a+string(filepath.Separator)), a, joinPath(a, b)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prependPath(tt.list, tt.dir); got != tt.want {
+				t.Errorf("prependPath(%q, %q) = %q, want %q", tt.list, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathContains(t *testing.T) {
+	a, b := filepath.FromSlash("/opt/a"), filepath.FromSlash("/opt/b")
+	tests := []struct {
+		name, list, dir string
+		want            bool
+	}{
+		{"empty", "", a, false},
+		{"present", joinPath(b, a), a, true},
+		{"absent", joinPath(b), a, false},
+		{"cleaned", joinPath(a + string(filepath.Separator)), a, true},
+		{"prefix only", joinPath(a + "x"), a, false},
+		{"empty entries", joinPath("", b, ""), a, false},
+	}
+	if isWindows {
+		tests = append(tests, struct {
+			name, list, dir string
+			want            bool
+		}{"case insensitive", `C:\PHP`, `c:\php`, true})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathContains(tt.list, tt.dir); got != tt.want {
+				t.Errorf("pathContains(%q, %q) = %v, want %v", tt.list, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// php-src 发布包所在的目录，文件名形如 php-8.3.4.tar.gz
+const defaultSourceURL = "https://www.php.net/distributions/"
+
+// php.net 的发布信息接口，返回某个版本的源码包及其 SHA-256
+const phpReleaseInfoURL = "https://www.php.net/releases/index.php?json&version="
+
+// 从源码编译的版本的编译器标识
+const sourceToolchain = "source"
+
+// php-src 发布包的目录，可以通过 source_url 设置
+func sourceURL() string {
+	if cfg.SourceURL != "" {
+		return cfg.SourceURL
+	}
+	return defaultSourceURL
+}
+
+// 内置的编译变体（+名称）和对应的 configure 参数，可以通过 variant.<名称> 设置覆盖或添加
+var builtinVariants = map[string]string{
+	"bcmath":   "--enable-bcmath",
+	"curl":     "--with-curl",
+	"debug":    "--enable-debug",
+	"fpm":      "--enable-fpm",
+	"gd":       "--enable-gd",
+	"gmp":      "--with-gmp",
+	"intl":     "--enable-intl",
+	"mbstring": "--enable-mbstring",
+	"mysql":    "--with-mysqli --with-pdo-mysql",
+	"openssl":  "--with-openssl",
+	"pgsql":    "--with-pgsql --with-pdo-pgsql",
+	"sockets":  "--enable-sockets",
+	"sodium":   "--with-sodium",
+	"zip":      "--with-zip",
+	"zlib":     "--with-zlib",
+	"zts":      "--enable-zts",
+}
+
+// php-src 发布包的文件名
+var sourceArchivePattern = regexp.MustCompile(`^php-(\d+\.\d+\.\d+(?:(?:alpha|beta|RC)\d+)?)\.tar\.gz$`)
+
+// 从源码编译需要完整版本号
+var sourceVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(?:(?:alpha|beta|RC)\d+)?$`)
+
+// 所有可用的变体：内置变体加上 variant.<名称> 设置
+func variantTable() map[string]string {
+	table := make(map[string]string, len(builtinVariants)+len(cfg.Variants))
+	for name, flags := range builtinVariants {
+		table[name] = flags
+	}
+	for name, flags := range cfg.Variants {
+		table[name] = flags
+	}
+	return table
+}
+
+// 从参数中分离出 +名称 形式的变体，返回其余参数和排序、去重后的变体
+func splitVariants(args []string) ([]string, []string) {
+	var rest []string
+	seen := make(map[string]bool)
+	var variants []string
+	for _, a := range args {
+		name, ok := strings.CutPrefix(a, "+")
+		if !ok {
+			rest = append(rest, a)
+			continue
+		}
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			variants = append(variants, name)
+		}
+	}
+	sort.Strings(variants)
+	return rest, variants
+}
+
+// 变体对应的 configure 参数
+func variantFlags(variants []string) ([]string, error) {
+	table := variantTable()
+	var flags []string
+	for _, name := range variants {
+		f, ok := table[name]
+		if !ok {
+			names := make([]string, 0, len(table))
+			for n := range table {
+				names = append(names, "+"+n)
+			}
+			sort.Strings(names)
+			return nil, usageErrorf("未知的变体: +%s\n可用的变体: %s\n也可以用 pvm config set variant.%s -- \"<configure 参数>\" 添加", name, strings.Join(names, " "), name)
+		}
+		flags = append(flags, strings.Fields(f)...)
+	}
+	return flags, nil
+}
+
+// 源码编译版本的目录名，例如 php-8.3.4-src-intl-pgsql
+func sourceDirName(version string, variants []string) string {
+	parts := append([]string{"php-" + version + "-src"}, variants...)
+	return strings.Join(parts, "-")
+}
+
+// 源码编译版本在清单中的名称，变体用 + 连接，例如 8.3.4+intl+pgsql，
+// 同一版本的不同变体可以同时安装
+func sourceKey(version string, variants []string) string {
+	return strings.Join(append([]string{version}, variants...), "+")
+}
+
+// php.net 公布的源码包 SHA-256，取不到时返回空字符串
+func sourceChecksum(ctx context.Context, version, filename string) string {
+	if offline {
+		return ""
+	}
+	body, err := openURL(ctx, phpReleaseInfoURL+version)
+	if err != nil {
+		debugf("获取源码包校验和失败: %v\n", err)
+		return ""
+	}
+	defer body.Close()
+	var info struct {
+		Source []struct {
+			Filename string `json:"filename"`
+			SHA256   string `json:"sha256"`
+		} `json:"source"`
+	}
+	if err := json.NewDecoder(body).Decode(&info); err != nil {
+		debugf("解析发布信息失败: %v\n", err)
+		return ""
+	}
+	for _, s := range info.Source {
+		if s.Filename == filename {
+			return strings.ToLower(s.SHA256)
+		}
+	}
+	return ""
+}
+
+// 从源码编译并安装（install --source）。archive 不为空时使用本地的 php-src 发布包，
+// 否则从 source_url 下载 version。清单中的名称由版本号和变体组成，见 sourceKey
+func installFromSource(ctx context.Context, version, archive string, variants []string) error {
+	if isWindows {
+		return usageErrorf("Windows 上不支持从源码编译，请使用官方构建")
+	}
+	flags, err := variantFlags(variants)
+	if err != nil {
+		return err
+	}
+	for _, tool := range []string{"make", "cc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("找不到 %s，从源码编译需要安装编译工具（例如 build-essential、autoconf、pkg-config、bison、re2c 和 libxml2 的开发包）", tool)
+		}
+	}
+	cleanTempArtifacts(staleTempAge)
+
+	record := installRecord{Source: sourceBuild, Toolchain: sourceToolchain, Arch: hostArch(), Flavour: "nts", Variants: variants}
+	for _, v := range variants {
+		if v == "zts" {
+			record.Flavour = "ts"
+		}
+	}
+
+	if archive != "" {
+		if archive, err = filepath.Abs(archive); err != nil {
+			return fmt.Errorf("无效的文件路径: %v", err)
+		}
+		if !isFile(archive) {
+			return withExit(exitNotFound, fmt.Errorf("找不到源码包: %s", archive))
+		}
+		m := sourceArchivePattern.FindStringSubmatch(filepath.Base(archive))
+		if m == nil {
+			return usageErrorf("无法从文件名识别版本: %s，源码包的文件名应形如 php-8.3.4.tar.gz", filepath.Base(archive))
+		}
+		record.Version = normalizeVersion(m[1])
+	} else {
+		record.Version = normalizeVersion(version)
+		if !sourceVersionPattern.MatchString(record.Version) {
+			return usageErrorf("从源码编译需要完整版本号，例如 pvm install --source 8.3.4")
+		}
+	}
+	key := sourceKey(record.Version, variants)
+	record.Dir = sourceDirName(record.Version, variants)
+
+	// 名称已经登记为其他目录（例如同一版本的官方构建）时不覆盖，以免原来的目录脱离清单
+	m, err := loadManifest()
+	if err != nil {
+		return err
+	}
+	if r, ok := m[key]; ok && r.Dir != record.Dir {
+		return fmt.Errorf("名称 %s 已被 %s 使用，请先运行 pvm uninstall %s", key, r.Dir, key)
+	}
+
+	if err := checkLifecycle(versionSeries(record.Version)); err != nil {
+		return err
+	}
+
+	filename := "php-" + record.Version + ".tar.gz"
+	var cache *downloadCache
+	downloaded := archive == ""
+	if downloaded {
+		infof("正在下载 PHP %s 的源码...\n", record.Version)
+		if cache, err = openDownloadCache(); err != nil {
+			return err
+		}
+		url, file, err := downloadFromMirror(ctx, cache, sourceURL(), []string{filename})
+		if err != nil {
+			return withExit(exitCodeOf(err), fmt.Errorf("下载失败: %v", err))
+		}
+		if url == "" {
+			return withExit(exitNotFound, fmt.Errorf("找不到源码包 %s%s", sourceURL(), filename))
+		}
+		archive = file
+	}
+	if record.SHA256, err = fileSHA256(archive); err != nil {
+		return fmt.Errorf("计算校验和失败: %v", err)
+	}
+	switch expected := sourceChecksum(ctx, record.Version, filename); {
+	case expected == "":
+		warnf("无法从 php.net 获取 %s 的校验和，源码包没有经过校验\n", filename)
+	case expected != record.SHA256:
+		err := fmt.Errorf("%s 校验失败: 期望 %s，实际 %s", filename, expected, record.SHA256)
+		if downloaded {
+			cache.forget(filename)
+			return withExit(exitChecksum, err)
+		}
+		return err
+	default:
+		debugf("%s 的校验和与 php.net 公布的一致\n", filename)
+	}
+
+	installed, cleanup, err := buildSource(ctx, archive, record, flags)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := installTree(ctx, key, installed, record); err != nil {
+		return err
+	}
+	return useVersion(ctx, key)
+}
+
+// 在临时目录中解压并编译源码，make install 安装到临时目录下，
+// 返回安装出的版本目录和清理临时目录的函数。编译输出写入 <根目录>/logs 下的日志文件
+func buildSource(ctx context.Context, archive string, record installRecord, flags []string) (string, func(), error) {
+	if err := os.MkdirAll(tempPath(), 0755); err != nil {
+		return "", nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	buildDir, err := os.MkdirTemp(tempPath(), "build-"+record.Dir+"-")
+	if err != nil {
+		return "", nil, fmt.Errorf("创建编译目录失败: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(buildDir) }
+
+	infof("正在解压源码...\n")
+	srcRoot := filepath.Join(buildDir, "src")
+	if err := extractTarGz(ctx, archive, srcRoot); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("解压源码失败: %v", err)
+	}
+	srcDir := srcRoot
+	if items, _ := filepath.Glob(filepath.Join(srcRoot, "*")); len(items) == 1 && isDir(items[0]) {
+		srcDir = items[0]
+	}
+	if !isFile(filepath.Join(srcDir, "configure")) {
+		cleanup()
+		return "", nil, fmt.Errorf("源码包中没有 configure 脚本: %s", archive)
+	}
+
+	logDir := filepath.Join(rootDir, "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	logPath := filepath.Join(logDir, "build-"+record.Dir+"-"+time.Now().Format("20060102-150405")+".log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("创建日志文件失败: %v", err)
+	}
+	defer logFile.Close()
+	infof("编译日志: %s\n", logPath)
+
+	// 安装路径固定为最终的版本目录，make install 先安装到临时目录，完成后再整体移动
+	versionDir := filepath.Join(phpsPath(), record.Dir)
+	installRoot := filepath.Join(buildDir, "install")
+	configure := append([]string{
+		"--prefix=" + versionDir,
+		"--with-config-file-path=" + versionDir,
+		"--with-config-file-scan-dir=" + filepath.Join(versionDir, "conf.d"),
+	}, flags...)
+	jobs := fmt.Sprintf("-j%d", runtime.NumCPU())
+	steps := []struct {
+		desc string
+		name string
+		args []string
+	}{
+		{"配置", "./configure", configure},
+		{"编译", "make", []string{jobs}},
+		{"安装", "make", []string{"install", "INSTALL_ROOT=" + installRoot}},
+	}
+	for _, step := range steps {
+		infof("正在%s: %s %s\n", step.desc, step.name, strings.Join(step.args, " "))
+		fmt.Fprintf(logFile, "$ %s %s\n", step.name, strings.Join(step.args, " "))
+		cmd := exec.CommandContext(ctx, step.name, step.args...)
+		cmd.Dir = srcDir
+		cmd.Stdout, cmd.Stderr = logFile, logFile
+		if err := cmd.Run(); err != nil {
+			cleanup()
+			if ctx.Err() != nil {
+				return "", nil, errInterrupted
+			}
+			return "", nil, fmt.Errorf("%s失败: %v\n日志的最后几行:\n%s完整日志: %s", step.desc, err, logTail(logPath, 20), logPath)
+		}
+	}
+
+	installed := filepath.Join(installRoot, versionDir)
+	if !isFile(filepath.Join(installed, "bin", phpBinary)) {
+		cleanup()
+		return "", nil, fmt.Errorf("make install 没有安装 %s，完整日志: %s", filepath.Join("bin", phpBinary), logPath)
+	}
+	// 安装 php.ini-development，installTree 据此创建 php.ini
+	if data, err := os.ReadFile(filepath.Join(srcDir, "php.ini-development")); err == nil {
+		os.WriteFile(filepath.Join(installed, "php.ini-development"), data, 0644)
+	}
+	os.MkdirAll(filepath.Join(installed, "conf.d"), 0755)
+	infof("编译完成\n")
+	return installed, cleanup, nil
+}
+
+// 日志文件的最后几行
+func logTail(path string, n int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "  " + strings.Join(lines, "\n  ") + "\n"
+}
+
+// 解析 variant.<名称> 设置的值
+func setVariant(name, value string) error {
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, "+ ") {
+		return errors.New("请指定变体名称，例如 variant.imagick")
+	}
+	if value == "" {
+		delete(cfg.Variants, name)
+		return nil
+	}
+	if cfg.Variants == nil {
+		cfg.Variants = make(map[string]string)
+	}
+	cfg.Variants[name] = value
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// 是否运行在 Windows 上。其他平台使用 static-php-cli 的静态构建
+const isWindows = runtime.GOOS == "windows"
+
+// static-php-cli 的静态构建目录，文件名形如 php-8.3.4-cli-linux-x86_64.tar.gz
+const defaultStaticURL = "https://dl.static-php.dev/static-php-cli/common/"
+
+// 静态构建的编译器标识
+const staticToolchain = "static"
+
+// 静态构建的目录，可以通过 static_url 设置
+func staticURL() string {
+	if cfg.StaticURL != "" {
+		return cfg.StaticURL
+	}
+	return defaultStaticURL
+}
+
+// 当前平台在静态构建文件名中的写法
+var staticOS = map[string]string{
+	"linux":  "linux",
+	"darwin": "macos",
+}[runtime.GOOS]
+
+// 静态构建文件名中的架构与 pvm 中的写法
+var staticArches = map[string]string{
+	"x86_64":  "x64",
+	"aarch64": "arm64",
+}
+
+// static-php-cli 的 CLI 压缩包，例如 php-8.3.4-cli-linux-x86_64.tar.gz
+var staticNamePattern = regexp.MustCompile(`^php-(\d+\.\d+\.\d+(?:(?:alpha|beta|RC)\d+)?)-cli-(linux|macos)-(x86_64|aarch64)(\.tar\.gz)?$`)
+
+// 解析静态构建的压缩包或目录名，只接受当前平台的构建
+func parseStaticBuildName(name string) (phpBuild, bool) {
+	m := staticNamePattern.FindStringSubmatch(name)
+	if m == nil || m[2] != staticOS {
+		return phpBuild{}, false
+	}
+	return phpBuild{
+		Version:   normalizeVersion(m[1]),
+		Flavour:   "nts",
+		Arch:      staticArches[m[3]],
+		Toolchain: staticToolchain,
+		File:      name,
+	}, true
+}
+
+// 静态构建的目录名，与压缩包同名（不带 .tar.gz）
+func staticDirName(b phpBuild) string {
+	arch := b.Arch
+	for name, a := range staticArches {
+		if a == b.Arch {
+			arch = name
+		}
+	}
+	return fmt.Sprintf("php-%s-cli-%s-%s", b.Version, staticOS, arch)
+}
+
+// 当前机器的架构。Windows 上默认选择 x64 构建
+func hostArch() string {
+	switch {
+	case isWindows:
+		return "x64"
+	case runtime.GOARCH == "arm64":
+		return "arm64"
+	case runtime.GOARCH == "386":
+		return "x86"
+	}
+	return "x64"
+}
+
+// 下载时依次尝试的地址：Windows 上为镜像列表，其他平台为静态构建目录
+func downloadMirrors() []string {
+	if isWindows {
+		return mirrors()
+	}
+	return []string{staticURL()}
+}
+
+// 读取静态构建目录中当前平台的所有构建
+func staticBuilds(ctx context.Context) ([]phpBuild, error) {
+	listing, err := readIndexPage(ctx, staticURL())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errInterrupted
+		}
+		return nil, withExit(exitCodeOf(err), fmt.Errorf("获取版本列表失败: %v", err))
+	}
+	recordRemoteVersions(listing)
+	return parseIndexBuilds(listing), nil
+}
+
+// 解压 .tar.gz 压缩包，只接受普通文件、目录和指向包内的符号链接
+func extractTarGz(ctx context.Context, archive, destDir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(&ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return interrupted(ctx, fmt.Errorf("读取 %s 失败: %v", archive, err))
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return interrupted(ctx, fmt.Errorf("解压 %s 失败: %v", archive, err))
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(destDir)+string(filepath.Separator)) {
+			return fmt.Errorf("压缩包中的路径无效: %s", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return interrupted(ctx, fmt.Errorf("解压 %s 失败: %v", hdr.Name, err))
+			}
+		case tar.TypeSymlink:
+			link := filepath.Join(filepath.Dir(target), hdr.Linkname)
+			if filepath.IsAbs(hdr.Linkname) || !strings.HasPrefix(link, filepath.Clean(destDir)+string(filepath.Separator)) {
+				return fmt.Errorf("压缩包中的符号链接无效: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			debugf("跳过压缩包中的 %s\n", hdr.Name)
+		}
+	}
+	infof("解压完成\n")
+	return nil
+}
+
+// 按扩展名解压压缩包
+func extractArchive(ctx context.Context, archive, destDir string) error {
+	name := strings.ToLower(archive)
+	if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+		return extractTarGz(ctx, archive, destDir)
+	}
+	return extractZip(ctx, archive, destDir)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 切换后同时运行 php -m，由 use --modules 设置
+var verifyModules bool
+
+// 运行 php 检查时的超时时间
+const verifyTimeout = 30 * time.Second
+
+// 运行 php_home 中的 php，返回标准输出和标准错误
+func runActivePHP(ctx context.Context, args ...string) (string, string, error) {
+	phpExe := filepath.Join(managedPathDir(), phpBinary)
+	if !isFile(phpExe) {
+		return "", "", fmt.Errorf("%s 不存在", phpExe)
+	}
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, phpExe, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s %s 在 %s 内没有结束", phpBinary, strings.Join(args, " "), verifyTimeout)
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+// 启动时的警告，例如无法加载扩展
+func startupWarnings(output string) []string {
+	var warnings []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "Warning") || strings.Contains(line, "Fatal error") || strings.Contains(line, "Unable to load") {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings
+}
+
+// 从 php -v 的输出中识别版本，启动警告可能出现在版本信息之前
+func versionFromOutput(output string) (phpBuild, bool) {
+	lines := strings.Split(output, "\n")
+	for i := range lines {
+		if strings.HasPrefix(lines[i], "PHP ") && !strings.HasPrefix(lines[i], "PHP Warning") {
+			return parsePHPVersionOutput(strings.Join(lines[i:], "\n"))
+		}
+	}
+	return phpBuild{}, false
+}
+
+// php -v 显示的版本是否与清单中的版本一致。快照在清单中只记录主次版本（8.4-dev），
+// php -v 显示完整版本（8.4.0-dev），比较主次版本和发布阶段
+func reportedVersionMatches(reported, want string) bool {
+	if isSnapshot(want) {
+		r, w := splitVersion(reported), splitVersion(want)
+		return r.stage == stageDev && (r.base == w.base || strings.HasPrefix(r.base, w.base+"."))
+	}
+	return normalizeVersion(reported) == normalizeVersion(want)
+}
+
+// 检查切换后的 php_home：php -v 能够运行并且版本与 want 一致，--modules 时 php -m 没有加载错误
+func verifySwitch(ctx context.Context, want string) error {
+	stdout, stderr, err := runActivePHP(ctx, "-v")
+	if err != nil {
+		if msg := strings.TrimSpace(stderr); msg != "" {
+			return fmt.Errorf("运行 php -v 失败: %v\n%s", err, msg)
+		}
+		return fmt.Errorf("运行 php -v 失败: %v", err)
+	}
+	b, ok := versionFromOutput(stdout)
+	if !ok {
+		return errors.New("无法识别 php -v 的输出")
+	}
+	if want != "" && !reportedVersionMatches(b.Version, want) {
+		return fmt.Errorf("php -v 显示的版本为 %s，应为 %s", b.Version, want)
+	}
+	debugf("php -v: %s\n", b.Version)
+	if !verifyModules {
+		return nil
+	}
+
+	stdout, stderr, err = runActivePHP(ctx, "-m")
+	if err != nil {
+		return fmt.Errorf("运行 php -m 失败: %v\n%s", err, strings.TrimSpace(stderr))
+	}
+	if warnings := startupWarnings(stderr + "\n" + stdout); len(warnings) > 0 {
+		return fmt.Errorf("php -m 报告了启动错误:\n  %s", strings.Join(warnings, "\n  "))
+	}
+	return nil
+}
+
+// 检查失败时恢复切换前的选择，之前没有当前版本时取消当前版本
+func rollbackSwitch(ctx context.Context, previous, previousDir string) error {
+	if previousDir == "" || !isDir(previousDir) {
+		infof("恢复到切换前的状态（没有当前版本）\n")
+		return clearActive()
+	}
+	infof("恢复到切换前的版本 %s\n", previous)
+	// 回滚不因之前的 Ctrl+C 而中止
+	return activateVersion(context.WithoutCancel(ctx), previous, previousDir)
+}
+
+// 切换前检查版本目录中的 php，从源码编译的版本位于 bin 子目录
+func hasPHPBinary(versionDir string) bool {
+	if isFile(filepath.Join(versionDir, phpBinary)) {
+		return true
+	}
+	return isFile(filepath.Join(versionDir, "bin", phpBinary))
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestVersionFromOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"release", "PHP 8.3.4 (cli) (built: Mar 12 2024 10:00:00) (NTS)\nCopyright (c) The PHP Group\nZend Engine v4.3.4\n", "8.3.4"},
+		{"release windows", "PHP 8.2.15 (cli) (built: Jan 16 2024 12:19:32) (NTS Visual C++ 2019 x64)\n", "8.2.15"},
+		{"rc", "PHP 8.4.0RC2 (cli) (built: Oct  8 2024 16:18:28) (ZTS Visual C++ 2022 x64)\n", "8.4.0RC2"},
+		{"beta", "PHP 8.4.0beta3 (cli) (built: Aug 13 2024 09:00:00) (NTS)\n", "8.4.0beta3"},
+		{"dev", "PHP 8.4.0-dev (cli) (built: Jun  1 2024 03:04:05) (NTS Visual C++ 2022 x64)\n", "8.4.0-dev"},
+		{"startup warning first", "PHP Warning:  PHP Startup: Unable to load dynamic library 'foo' in Unknown on line 0\nPHP 8.3.4 (cli) (built: Mar 12 2024) (NTS)\n", "8.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, ok := versionFromOutput(tt.output)
+			if !ok || b.Version != tt.want {
+				t.Errorf("versionFromOutput = %q, %v; want %q", b.Version, ok, tt.want)
+			}
+		})
+	}
+	if _, ok := versionFromOutput("php: command not found\n"); ok {
+		t.Errorf("versionFromOutput accepted unrelated output")
+	}
+}
+
+func TestReportedVersionMatches(t *testing.T) {
+	tests := []struct {
+		reported, want string
+		match          bool
+	}{
+		{"8.3.4", "8.3.4", true},
+		{"8.3.4", "8.3.5", false},
+		{"8.4.0RC2", "8.4.0RC2", true},
+		{"8.4.0RC2", "8.4.0rc2", true},
+		{"8.4.0RC2", "8.4.0RC1", false},
+		{"8.4.0RC2", "8.4.0", false},
+		{"8.4.0-dev", "8.4-dev", true},
+		{"8.4.1-dev", "8.4-dev", true},
+		{"8.4.0-dev", "8.4.0-dev", true},
+		{"8.5.0-dev", "8.4-dev", false},
+		{"8.4.0", "8.4-dev", false},
+		{"8.4.0RC1", "8.4-dev", false},
+		{"8.40.0-dev", "8.4-dev", false},
+	}
+	for _, tt := range tests {
+		if got := reportedVersionMatches(tt.reported, tt.want); got != tt.match {
+			t.Errorf("reportedVersionMatches(%q, %q) = %v, want %v", tt.reported, tt.want, got, tt.match)
+		}
+	}
+}